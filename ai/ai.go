@@ -0,0 +1,14 @@
+// Computer players for squares games
+package ai
+
+import squares "github.com/iBug/Squares-go"
+
+type Player interface {
+	// Pick a move for playerId without modifying game, false if there's no legal move
+	ChooseMove(game *squares.Game, playerId int) (squares.Move, bool)
+}
+
+// Number of squares in a shape of the game's piece set
+func shapeSize(game *squares.Game, shapeId int) int {
+	return game.Rules.PieceSet().Shapes[shapeId].Size()
+}
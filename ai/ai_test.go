@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"testing"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+func TestBotsPlayLegalMoves(t *testing.T) {
+	bots := map[string]Player{"random": NewRandomPlayer(1), "greedy": NewGreedyPlayer(1)}
+	for name, bot := range bots {
+		for _, rules := range squares.VARIANTS {
+			game := squares.NewGame(rules)
+			for game.ActivePlayer >= 0 {
+				m, ok := bot.ChooseMove(game, game.ActivePlayer)
+				if !ok {
+					t.Fatalf("%s, %s: no move for player %d", name, rules.Name, game.ActivePlayer+1)
+				}
+				if err := game.ValidateMove(m); err != nil {
+					t.Fatalf("%s, %s: %s: %v", name, rules.Name, rules.PieceSet().FormatMove(m), err)
+				}
+				playMove(game, m)
+			}
+
+			// Nothing left to play
+			for p := 0; p < rules.NPlayers; p++ {
+				if m, ok := bot.ChooseMove(game, p); ok {
+					t.Errorf("%s, %s: got move %s for player %d after the game", name, rules.Name, rules.PieceSet().FormatMove(m), p+1)
+				}
+			}
+		}
+	}
+}
+
+func TestGreedyPrefersLargerPieces(t *testing.T) {
+	greedy := NewGreedyPlayer(1)
+	game := squares.NewGame(squares.RULES_DUO)
+	for game.ActivePlayer >= 0 {
+		largest := 0
+		for _, m := range game.LegalMoves(game.ActivePlayer) {
+			if size := shapeSize(game, m.ShapeId); size > largest {
+				largest = size
+			}
+		}
+		m, _ := greedy.ChooseMove(game, game.ActivePlayer)
+		if size := shapeSize(game, m.ShapeId); size != largest {
+			t.Fatalf("%s: played %s of %d squares, %d possible",
+				game.MarshalPosition(), game.Rules.PieceSet().FormatMove(m), size, largest)
+		}
+		playMove(game, m)
+	}
+}
+
+// Among pieces of the same size the one opening more corners wins
+func TestGreedyPrefersAnchorGain(t *testing.T) {
+	greedy := NewGreedyPlayer(1)
+	greedy.SizeWeight = 0
+	game := squares.NewGame(squares.RULES_DUO)
+	playMoves(game, NewRandomPlayer(1), 10)
+	best := -1 << 30
+	for _, m := range game.LegalMoves(game.ActivePlayer) {
+		if gain := game.AnchorGain(m); gain > best {
+			best = gain
+		}
+	}
+	m, _ := greedy.ChooseMove(game, game.ActivePlayer)
+	if gain := game.AnchorGain(m); gain != best {
+		t.Errorf("played %s gaining %d anchors, %d possible", game.Rules.PieceSet().FormatMove(m), gain, best)
+	}
+}
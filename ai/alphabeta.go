@@ -0,0 +1,260 @@
+package ai
+
+import (
+	"sort"
+	"time"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+const (
+	AB_DEFAULT_DEPTH    = 2
+	AB_DEFAULT_MOBILITY = 1
+
+	AB_INFINITY = 1 << 30
+	AB_WIN      = 1 << 20 // Added to the score difference of finished games
+)
+
+// Iterative-deepening alpha-beta search, meant for the two-player variants.
+// With more players it plays paranoid: every opponent is assumed to play
+// against the searching player.
+//
+// Positions are evaluated by the difference between the player's score and
+// the best opponent's (SCORING_ADVANCED), plus the difference in the number
+// of anchor cells weighted by Mobility. Anchors stand in for legal moves,
+// which are too slow to count at every leaf.
+type AlphaBetaPlayer struct {
+	MaxDepth  int           // 0 = until TimeLimit
+	TimeLimit time.Duration // 0 = no limit. Depth 1 is always completed.
+	Mobility  int           // Weight of an anchor cell in the evaluation
+
+	LastResult SearchResult // Result of the most recent search
+}
+
+// Outcome and statistics of a search
+type SearchResult struct {
+	Score   int            // From the searching player's point of view
+	PV      []squares.Move // Principal variation, best move first
+	Depth   int            // Deepest completed iteration
+	Nodes   int            // Positions visited, including leaves
+	TTHits  int            // Positions found in the transposition table
+	Cutoffs int            // Beta cutoffs
+	Elapsed time.Duration
+}
+
+func NewAlphaBetaPlayer() *AlphaBetaPlayer {
+	return &AlphaBetaPlayer{MaxDepth: AB_DEFAULT_DEPTH, Mobility: AB_DEFAULT_MOBILITY}
+}
+
+type ttFlag int
+
+const (
+	TT_EXACT ttFlag = iota
+	TT_LOWER        // Score is at least the stored one
+	TT_UPPER        // Score is at most the stored one
+)
+
+type ttEntry struct {
+	depth int
+	score int
+	flag  ttFlag
+	pv    []squares.Move // Best line found from the position, never modified
+}
+
+type abSearch struct {
+	*AlphaBetaPlayer
+	game     *squares.Game // Searched in place, restored by Undo
+	root     int
+	deadline time.Time
+	depth    int  // Of the current iteration
+	horizon  bool // Whether the iteration stopped at an unfinished game
+	aborted  bool
+	tt       map[uint64]ttEntry
+	result   SearchResult
+}
+
+func (p *AlphaBetaPlayer) ChooseMove(game *squares.Game, playerId int) (squares.Move, bool) {
+	result := p.Search(game, playerId)
+	if len(result.PV) == 0 {
+		return squares.Move{}, false
+	}
+	return result.PV[0], true
+}
+
+// Analyze the position for playerId, who is assumed to move next
+func (p *AlphaBetaPlayer) Search(game *squares.Game, playerId int) SearchResult {
+	start := time.Now()
+	s := &abSearch{
+		AlphaBetaPlayer: p,
+		game:            game.Clone(),
+		root:            playerId,
+		tt:              make(map[uint64]ttEntry),
+	}
+	s.game.ActivePlayer = playerId
+	maxDepth := p.MaxDepth
+	if p.TimeLimit > 0 {
+		s.deadline = start.Add(p.TimeLimit)
+	} else if maxDepth <= 0 {
+		maxDepth = AB_DEFAULT_DEPTH
+	}
+
+	var best SearchResult
+	for s.depth = 1; maxDepth <= 0 || s.depth <= maxDepth; s.depth++ {
+		s.horizon = false
+		score, pv := s.alphaBeta(s.depth, 0, -AB_INFINITY, AB_INFINITY)
+		if s.aborted {
+			break
+		}
+		best.Score, best.PV, best.Depth = score, pv, s.depth
+		if !s.horizon {
+			break // Every line ends the game, searching deeper won't change anything
+		}
+	}
+	best.Nodes, best.TTHits, best.Cutoffs = s.result.Nodes, s.result.TTHits, s.result.Cutoffs
+	best.Elapsed = time.Since(start)
+	p.LastResult = best
+	return best
+}
+
+// Minimax with alpha-beta pruning, the root player maximizes
+func (s *abSearch) alphaBeta(depth, ply, alpha, beta int) (int, []squares.Move) {
+	s.result.Nodes++
+	// Only give up after depth 1 so there's always a move to play
+	if s.depth > 1 && !s.deadline.IsZero() && s.result.Nodes%256 == 0 && time.Now().After(s.deadline) {
+		s.aborted = true
+	}
+	if s.aborted {
+		return 0, nil
+	}
+	game := s.game
+	if game.ActivePlayer < 0 {
+		return s.evaluate(), nil
+	}
+	if depth == 0 {
+		s.horizon = true
+		return s.evaluate(), nil
+	}
+
+	hash := game.Hash()
+	entry, found := s.tt[hash]
+	if found {
+		s.result.TTHits++
+		if ply > 0 && entry.depth >= depth {
+			switch {
+			case entry.flag == TT_EXACT,
+				entry.flag == TT_LOWER && entry.score >= beta,
+				entry.flag == TT_UPPER && entry.score <= alpha:
+				return entry.score, entry.pv
+			}
+		}
+	}
+
+	moves := game.LegalMoves(game.ActivePlayer)
+	if len(moves) == 0 {
+		return s.evaluate(), nil
+	}
+	var ttMove *squares.Move
+	if found {
+		ttMove = &entry.pv[0]
+	}
+	s.orderMoves(moves, ttMove)
+
+	maximizing := game.ActivePlayer == s.root
+	origAlpha, origBeta := alpha, beta
+	best := -AB_INFINITY
+	if !maximizing {
+		best = AB_INFINITY
+	}
+	var bestPV []squares.Move
+	for _, m := range moves {
+		game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+		game.AfterMove()
+		score, pv := s.alphaBeta(depth-1, ply+1, alpha, beta)
+		game.Undo()
+		if s.aborted {
+			return 0, nil
+		}
+
+		if maximizing && score > best || !maximizing && score < best {
+			best = score
+			bestPV = append([]squares.Move{m}, pv...)
+		}
+		if maximizing && best > alpha {
+			alpha = best
+		} else if !maximizing && best < beta {
+			beta = best
+		}
+		if alpha >= beta {
+			s.result.Cutoffs++
+			break
+		}
+	}
+
+	flag := TT_EXACT
+	if best <= origAlpha {
+		flag = TT_UPPER
+	} else if best >= origBeta {
+		flag = TT_LOWER
+	}
+	s.tt[hash] = ttEntry{depth, best, flag, bestPV}
+	return best, bestPV
+}
+
+// Try the best move from an earlier iteration first, then large pieces and
+// moves opening many new corners
+func (s *abSearch) orderMoves(moves []squares.Move, ttMove *squares.Move) {
+	type orderedMove struct {
+		move squares.Move
+		key  int
+	}
+	ordered := make([]orderedMove, len(moves))
+	for i, m := range moves {
+		ordered[i] = orderedMove{m, 100*shapeSize(s.game, m.ShapeId) + s.game.AnchorGain(m)}
+		if ttMove != nil && m == *ttMove {
+			ordered[i].key = AB_INFINITY
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].key > ordered[j].key
+	})
+	for i := range ordered {
+		moves[i] = ordered[i].move
+	}
+}
+
+func (s *abSearch) evaluate() int {
+	game := s.game
+	score := game.Score(s.root, squares.SCORING_ADVANCED)
+	best := -AB_INFINITY
+	for p := 0; p < game.Rules.NPlayers; p++ {
+		if p != s.root && game.Score(p, squares.SCORING_ADVANCED) > best {
+			best = game.Score(p, squares.SCORING_ADVANCED)
+		}
+	}
+	diff := score - best
+	if game.ActivePlayer < 0 {
+		if diff > 0 {
+			return AB_WIN + diff
+		} else if diff < 0 {
+			return -AB_WIN + diff
+		}
+		return 0
+	}
+	if game.FirstRound || s.Mobility == 0 {
+		return diff // Players who have placed their first piece have no moves until the round is over
+	}
+
+	mobility := func(p int) int {
+		if game.GetLostPlayers()&(1<<p) != 0 {
+			return 0 // Anchors are left, but no moves
+		}
+		return game.AnchorCount(p)
+	}
+	bestMobility := 0
+	for p := 0; p < game.Rules.NPlayers; p++ {
+		if p != s.root && mobility(p) > bestMobility {
+			bestMobility = mobility(p)
+		}
+	}
+	return diff + s.Mobility*(mobility(s.root)-bestMobility)
+}
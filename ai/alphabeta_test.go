@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+// A 6x6 board with pieces of up to three squares, small enough to be solved
+func tinyRules(t *testing.T) squares.Rules {
+	pieces, err := squares.GeneratePieceSet("tiny", 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := squares.Rules{
+		Name: "tiny", Width: 6, Height: 6, NPlayers: 2,
+		Starts: []squares.Coord{{X: 1, Y: 1}, {X: 4, Y: 4}}, TurnOrder: []int{0, 1}, Pieces: pieces,
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+// Play n moves of player, or until the game is over
+func playMoves(game *squares.Game, player Player, n int) {
+	for i := 0; i < n && game.ActivePlayer >= 0; i++ {
+		m, ok := player.ChooseMove(game, game.ActivePlayer)
+		if !ok {
+			return
+		}
+		playMove(game, m)
+	}
+}
+
+// Result of perfect play for root by plain minimax: 1 for a win, 0 for a draw, -1 for a loss
+func solve(game *squares.Game, root int) int {
+	if game.ActivePlayer < 0 {
+		diff := game.Score(root, squares.SCORING_ADVANCED) - game.Score(1-root, squares.SCORING_ADVANCED)
+		switch {
+		case diff > 0:
+			return 1
+		case diff < 0:
+			return -1
+		}
+		return 0
+	}
+	maximizing := game.ActivePlayer == root
+	best := 2
+	if maximizing {
+		best = -2
+	}
+	for _, m := range game.LegalMoves(game.ActivePlayer) {
+		next := game.Clone()
+		playMove(next, m)
+		if v := solve(next, root); maximizing && v > best || !maximizing && v < best {
+			best = v
+		}
+	}
+	return best
+}
+
+// Unused pieces of all players
+func remainingPieces(game *squares.Game) int {
+	n := 0
+	for _, used := range game.ChessUsed {
+		for _, u := range used {
+			if !u {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Whenever a single move wins, or is the only one that doesn't lose, the
+// search must play it
+func TestAlphaBetaFindsOnlyBestMove(t *testing.T) {
+	rules := tinyRules(t)
+	random := NewRandomPlayer(1)
+	ab := &AlphaBetaPlayer{MaxDepth: 2 * rules.PieceSet().Len()}
+	tested := 0
+	for i := 0; i < 20; i++ {
+		game := squares.NewGame(rules)
+		for game.ActivePlayer >= 0 {
+			if remainingPieces(game) <= 5 {
+				root := game.ActivePlayer
+				moves := game.LegalMoves(root)
+				outcomes := make([]int, len(moves))
+				best, worst, nBest := -2, 2, 0
+				for j, m := range moves {
+					next := game.Clone()
+					playMove(next, m)
+					outcomes[j] = solve(next, root)
+					if outcomes[j] > best {
+						best, nBest = outcomes[j], 0
+					}
+					if outcomes[j] == best {
+						nBest++
+					}
+					if outcomes[j] < worst {
+						worst = outcomes[j]
+					}
+				}
+				if nBest == 1 && worst < best {
+					tested++
+					m, ok := ab.ChooseMove(game, root)
+					for j := range moves {
+						if ok && moves[j] == m && outcomes[j] != best {
+							t.Errorf("%s: played %s with outcome %d, a move with %d exists",
+								game.MarshalPosition(), rules.PieceSet().FormatMove(m), outcomes[j], best)
+						}
+					}
+				}
+			}
+			playMoves(game, random, 1)
+		}
+	}
+	if tested == 0 {
+		t.Error("no positions with a single best move found")
+	}
+}
+
+// The principal variation is a legal line as long as the search, or up to
+// the end of the game
+func TestAlphaBetaPrincipalVariation(t *testing.T) {
+	rules := tinyRules(t)
+	random := NewRandomPlayer(2)
+	for i := 0; i < 20; i++ {
+		game := squares.NewGame(rules)
+		playMoves(game, random, i%6)
+		for _, depth := range []int{1, 3, 2 * rules.PieceSet().Len()} {
+			ab := &AlphaBetaPlayer{MaxDepth: depth, Mobility: 1}
+			result := ab.Search(game, game.ActivePlayer)
+			line := game.Clone()
+			for j, m := range result.PV {
+				if err := line.ValidateMove(m); err != nil {
+					t.Fatalf("%s, depth %d: move %d of the PV: %v", game.MarshalPosition(), depth, j+1, err)
+				}
+				playMove(line, m)
+			}
+			if len(result.PV) != result.Depth && line.ActivePlayer >= 0 {
+				t.Errorf("%s, depth %d: PV of %d moves after searching to depth %d",
+					game.MarshalPosition(), depth, len(result.PV), result.Depth)
+			}
+		}
+	}
+}
+
+// Searching again hits the transposition table right below the root, the
+// entries must keep the whole line
+func TestAlphaBetaPrincipalVariationFromTT(t *testing.T) {
+	game := squares.NewGame(tinyRules(t))
+	playMoves(game, NewRandomPlayer(4), 2)
+	s := &abSearch{
+		AlphaBetaPlayer: &AlphaBetaPlayer{Mobility: 1},
+		game:            game.Clone(),
+		root:            game.ActivePlayer,
+		depth:           3,
+		tt:              make(map[uint64]ttEntry),
+	}
+	score, pv := s.alphaBeta(3, 0, -AB_INFINITY, AB_INFINITY)
+	hits := s.result.TTHits
+	again, pvAgain := s.alphaBeta(3, 0, -AB_INFINITY, AB_INFINITY)
+	if s.result.TTHits == hits {
+		t.Fatal("no transposition table hits searching again")
+	}
+	if again != score || !reflect.DeepEqual(pvAgain, pv) {
+		t.Errorf("searching again: got %d %v, want %d %v", again, pvAgain, score, pv)
+	}
+}
+
+// A time limit stops the search, but depth 1 is always completed
+func TestAlphaBetaTimeLimit(t *testing.T) {
+	game := squares.NewGame(squares.RULES_CLASSIC)
+	playMoves(game, NewRandomPlayer(3), 8)
+	for _, limit := range []time.Duration{time.Nanosecond, 100 * time.Millisecond} {
+		ab := &AlphaBetaPlayer{TimeLimit: limit, Mobility: 1}
+		result := ab.Search(game, game.ActivePlayer)
+		if result.Depth < 1 || len(result.PV) == 0 {
+			t.Errorf("limit %v: got depth %d and PV %v, want at least one move", limit, result.Depth, result.PV)
+		} else if err := game.ValidateMove(result.PV[0]); err != nil {
+			t.Errorf("limit %v: best move %v: %v", limit, result.PV[0], err)
+		}
+		if result.Elapsed > limit+time.Second {
+			t.Errorf("limit %v: searched for %v", limit, result.Elapsed)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"math/rand"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+// Plays the largest piece it can, preferring moves that open up the most new anchor cells.
+// Ties are broken randomly.
+type GreedyPlayer struct {
+	SizeWeight   int
+	AnchorWeight int
+
+	rng *rand.Rand
+}
+
+func NewGreedyPlayer(seed int64) *GreedyPlayer {
+	return &GreedyPlayer{
+		SizeWeight:   100,
+		AnchorWeight: 1,
+		rng:          rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (p *GreedyPlayer) Evaluate(game *squares.Game, m squares.Move) int {
+	return p.SizeWeight*shapeSize(game, m.ShapeId) + p.AnchorWeight*game.AnchorGain(m)
+}
+
+func (p *GreedyPlayer) ChooseMove(game *squares.Game, playerId int) (squares.Move, bool) {
+	moves := game.LegalMoves(playerId)
+	if len(moves) == 0 {
+		return squares.Move{}, false
+	}
+	best := make([]squares.Move, 0)
+	bestScore := 0
+	for _, m := range moves {
+		score := p.Evaluate(game, m)
+		if len(best) == 0 || score > bestScore {
+			best = append(best[:0], m)
+			bestScore = score
+		} else if score == bestScore {
+			best = append(best, m)
+		}
+	}
+	return best[p.rng.Intn(len(best))], true
+}
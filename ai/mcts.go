@@ -0,0 +1,216 @@
+package ai
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+// How moves are picked when a playout leaves the search tree
+type PlayoutPolicy int
+
+const (
+	PLAYOUT_RANDOM PlayoutPolicy = iota // RandomPlayer
+	PLAYOUT_GREEDY                      // GreedyPlayer
+)
+
+const (
+	MCTS_DEFAULT_ITERATIONS  = 1000
+	MCTS_DEFAULT_EXPLORATION = 0.7
+)
+
+// Monte Carlo Tree Search with UCT selection and max-n backup: every node
+// keeps the total reward of each player, and the player to move at a node
+// picks the child that is best for themselves.
+//
+// Each worker grows its own tree from the root (root parallelism) and the
+// visit counts of the root moves are added up. With an iteration budget the
+// chosen moves only depend on the seed, a time limit makes them depend on
+// the machine as well.
+type MCTSPlayer struct {
+	Iterations  int           // Playouts per worker, 0 = until TimeLimit
+	TimeLimit   time.Duration // 0 = no limit
+	Workers     int           // Trees searched in parallel, at least 1
+	Exploration float64       // UCT exploration constant
+	Playout     PlayoutPolicy
+
+	rng *rand.Rand
+}
+
+func NewMCTSPlayer(seed int64) *MCTSPlayer {
+	return &MCTSPlayer{
+		Iterations:  MCTS_DEFAULT_ITERATIONS,
+		Workers:     1,
+		Exploration: MCTS_DEFAULT_EXPLORATION,
+		Playout:     PLAYOUT_RANDOM,
+		rng:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+type mctsNode struct {
+	move     squares.Move // Move leading to this node
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []squares.Move
+	visits   int
+	reward   [squares.NPLAYERS]float64 // Sum over all playouts through this node
+}
+
+func (p *MCTSPlayer) ChooseMove(game *squares.Game, playerId int) (squares.Move, bool) {
+	moves := game.LegalMoves(playerId)
+	if len(moves) == 0 {
+		return squares.Move{}, false
+	}
+	if len(moves) == 1 {
+		return moves[0], true
+	}
+
+	root := game.Clone()
+	root.ActivePlayer = playerId
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var deadline time.Time
+	if p.TimeLimit > 0 {
+		deadline = time.Now().Add(p.TimeLimit)
+	}
+	// Draw all seeds up front so the result doesn't depend on scheduling
+	seeds := make([]int64, workers)
+	for i := range seeds {
+		seeds[i] = p.rng.Int63()
+	}
+
+	visits := make([][]int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			visits[i] = p.search(root, moves, seeds[i], deadline)
+		}(i)
+	}
+	wg.Wait()
+
+	best, bestVisits := 0, -1
+	for j := range moves {
+		total := 0
+		for i := range visits {
+			total += visits[i][j]
+		}
+		if total > bestVisits {
+			best, bestVisits = j, total
+		}
+	}
+	return moves[best], true
+}
+
+// Grow a tree from root and return the visit count of each root move
+func (p *MCTSPlayer) search(root *squares.Game, moves []squares.Move, seed int64, deadline time.Time) []int {
+	rng := rand.New(rand.NewSource(seed))
+	var playout Player
+	switch p.Playout {
+	case PLAYOUT_GREEDY:
+		playout = NewGreedyPlayer(rng.Int63())
+	default:
+		playout = NewRandomPlayer(rng.Int63())
+	}
+
+	tree := &mctsNode{untried: append([]squares.Move(nil), moves...)}
+	iterations := p.Iterations
+	if iterations <= 0 && deadline.IsZero() {
+		iterations = MCTS_DEFAULT_ITERATIONS
+	}
+	for i := 0; iterations <= 0 || i < iterations; i++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		game := root.Clone()
+
+		// Selection
+		node := tree
+		for len(node.untried) == 0 && len(node.children) > 0 {
+			node = node.selectChild(p.Exploration)
+			playMove(game, node.move)
+		}
+
+		// Expansion
+		if len(node.untried) > 0 {
+			k := rng.Intn(len(node.untried))
+			m := node.untried[k]
+			node.untried[k] = node.untried[len(node.untried)-1]
+			node.untried = node.untried[:len(node.untried)-1]
+			playMove(game, m)
+			child := &mctsNode{move: m, parent: node}
+			if game.ActivePlayer >= 0 {
+				child.untried = game.LegalMoves(game.ActivePlayer)
+			}
+			node.children = append(node.children, child)
+			node = child
+		}
+
+		// Simulation
+		for game.ActivePlayer >= 0 {
+			m, ok := playout.ChooseMove(game, game.ActivePlayer)
+			if !ok {
+				break
+			}
+			playMove(game, m)
+		}
+
+		// Backpropagation
+		reward := playoutReward(game)
+		for ; node != nil; node = node.parent {
+			node.visits++
+			for j := range reward {
+				node.reward[j] += reward[j]
+			}
+		}
+	}
+
+	// Children were expanded in random order, map them back to the root moves
+	visits := make([]int, len(moves))
+	for _, child := range tree.children {
+		for j, m := range moves {
+			if child.move == m {
+				visits[j] = child.visits
+				break
+			}
+		}
+	}
+	return visits
+}
+
+// UCT: the child with the best average reward for the player who moved into it
+// plus an exploration bonus for rarely visited children
+func (node *mctsNode) selectChild(exploration float64) *mctsNode {
+	logVisits := math.Log(float64(node.visits))
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	for _, child := range node.children {
+		value := child.reward[child.move.PlayerId]/float64(child.visits) +
+			exploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+func playMove(game *squares.Game, m squares.Move) {
+	game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+	game.AfterMove()
+}
+
+// 1 for a win, shared between tied winners, 0 for everyone else
+func playoutReward(game *squares.Game) [squares.NPLAYERS]float64 {
+	var reward [squares.NPLAYERS]float64
+	winners := squares.Winners(game.Standings(squares.SCORING_ADVANCED))
+	for _, w := range winners {
+		reward[w] = 1 / float64(len(winners))
+	}
+	return reward
+}
@@ -0,0 +1,46 @@
+package ai
+
+import (
+	"testing"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+// With an iteration budget the move only depends on the seed, however many
+// workers search
+func TestMCTSSameSeedSameMove(t *testing.T) {
+	game := squares.NewGame(squares.RULES_DUO)
+	playMoves(game, NewRandomPlayer(1), 20)
+	for _, workers := range []int{1, 4} {
+		for _, policy := range []PlayoutPolicy{PLAYOUT_RANDOM, PLAYOUT_GREEDY} {
+			var moves [2]squares.Move
+			for i := range moves {
+				p := NewMCTSPlayer(42)
+				p.Iterations, p.Workers, p.Playout = 20, workers, policy
+				m, ok := p.ChooseMove(game, game.ActivePlayer)
+				if !ok {
+					t.Fatal("no move found")
+				}
+				if err := game.ValidateMove(m); err != nil {
+					t.Fatalf("%v: %v", m, err)
+				}
+				moves[i] = m
+			}
+			if moves[0] != moves[1] {
+				t.Errorf("%d workers, policy %d: got %v and %v with the same seed", workers, policy, moves[0], moves[1])
+			}
+		}
+	}
+}
+
+// Nothing to play once the game is over
+func TestMCTSNoMove(t *testing.T) {
+	game := squares.NewGame(squares.RULES_DUO)
+	playMoves(game, NewRandomPlayer(1), 200)
+	if game.ActivePlayer >= 0 {
+		t.Fatal("game not over")
+	}
+	if m, ok := NewMCTSPlayer(1).ChooseMove(game, 0); ok {
+		t.Errorf("got move %v after the game", m)
+	}
+}
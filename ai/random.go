@@ -0,0 +1,24 @@
+package ai
+
+import (
+	"math/rand"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+// Plays a uniformly random legal move
+type RandomPlayer struct {
+	rng *rand.Rand
+}
+
+func NewRandomPlayer(seed int64) *RandomPlayer {
+	return &RandomPlayer{rand.New(rand.NewSource(seed))}
+}
+
+func (p *RandomPlayer) ChooseMove(game *squares.Game, playerId int) (squares.Move, bool) {
+	moves := game.LegalMoves(playerId)
+	if len(moves) == 0 {
+		return squares.Move{}, false
+	}
+	return moves[p.rng.Intn(len(moves))], true
+}
@@ -0,0 +1,53 @@
+package squares
+
+import "math/bits"
+
+const BITBOARD_WORDS = 8 // enough for boards up to 22x22
+
+// One bit for every cell on the board, see Game.CellIndex for the layout
+type Bitboard [BITBOARD_WORDS]uint64
+
+func (b *Bitboard) Set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b *Bitboard) Test(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+// Check if any cell is set in both bitboards
+func (b *Bitboard) Intersects(b2 *Bitboard) bool {
+	for i := range b {
+		if b[i]&b2[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Clear all cells that are set in b2
+func (b *Bitboard) AndNot(b2 *Bitboard) {
+	for i := range b {
+		b[i] &^= b2[i]
+	}
+}
+
+func (b *Bitboard) Count() int {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// List the indices of all set cells in ascending order
+func (b *Bitboard) Indices() []int {
+	indices := make([]int, 0, b.Count())
+	for i, w := range b {
+		for w != 0 {
+			indices = append(indices, i*64+bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+	return indices
+}
@@ -0,0 +1,197 @@
+package squares
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Make up to n random legal moves, fewer if the game ends
+func playRandomMoves(game *Game, r *rand.Rand, n int) {
+	for i := 0; i < n && game.ActivePlayer >= 0; i++ {
+		moves := game.LegalMoves(game.ActivePlayer)
+		m := moves[r.Intn(len(moves))]
+		game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+		game.AfterMove()
+	}
+}
+
+// TryInsert as it was before the bitboards, walking the board array
+func referenceTryInsert(game *Game, shapeId, rotation int, pos Coord, playerId int, firstRound bool) bool {
+	if game.ChessUsed[playerId][shapeId] {
+		return false
+	}
+	shape := game.Rules.PieceSet().Shape(shapeId, rotation)
+	for i := range shape.Grids {
+		shape.Grids[i] = shape.Grids[i].Add(pos)
+		if !game.InRange(shape.Grids[i]) || game.At(shape.Grids[i].X, shape.Grids[i].Y) >= 0 {
+			return false
+		}
+	}
+	canPlace := false
+	for _, grid := range shape.Grids {
+		if firstRound {
+			canPlace = canPlace || grid == game.Rules.Starts[playerId]
+			continue
+		}
+		for _, edge := range EDGES {
+			if check := grid.Add(edge); game.InRange(check) && game.At(check.X, check.Y) == playerId {
+				return false
+			}
+		}
+		for _, corner := range CORNERS {
+			if check := grid.Add(corner); game.InRange(check) && game.At(check.X, check.Y) == playerId {
+				canPlace = true
+			}
+		}
+	}
+	return canPlace
+}
+
+func TestTryInsertMatchesReference(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, rules := range VARIANTS {
+		for _, n := range []int{0, 2, 12, 40} {
+			game := NewGame(rules)
+			playRandomMoves(game, r, n)
+			pieces := game.Rules.PieceSet()
+			for playerId := 0; playerId < rules.NPlayers; playerId++ {
+				canMove := false
+				for shapeId := 0; shapeId < pieces.Len(); shapeId++ {
+					for rotation := 0; rotation < NROTATIONS; rotation++ {
+						for y := -2; y < rules.Height+2; y++ {
+							for x := -2; x < rules.Width+2; x++ {
+								pos := Coord{x, y}
+								got := game.TryInsert(shapeId, rotation, pos, playerId, game.FirstRound)
+								want := referenceTryInsert(game, shapeId, rotation, pos, playerId, game.FirstRound)
+								if got != want {
+									t.Fatalf("%s after %d moves: TryInsert(%d, %d, %v, %d) = %v, want %v",
+										rules.Name, len(game.History), shapeId, rotation, pos, playerId, got, want)
+								}
+								canMove = canMove || got
+							}
+						}
+					}
+				}
+				if !game.FirstRound && game.CheckPlayer(playerId) != canMove {
+					t.Fatalf("%s after %d moves: CheckPlayer(%d) = %v, want %v",
+						rules.Name, len(game.History), playerId, !canMove, canMove)
+				}
+			}
+		}
+	}
+}
+
+// Anchor cells as they were found before the bitboards, walking the board array
+func referenceAnchorCells(game *Game, playerId int) []Coord {
+	// 0: free, 1: diagonally adjacent to an own piece, 2: occupied or edge-adjacent
+	status := make([][]int, game.Rules.Height)
+	for y := range status {
+		status[y] = make([]int, game.Rules.Width)
+	}
+	for y := 0; y < game.Rules.Height; y++ {
+		for x := 0; x < game.Rules.Width; x++ {
+			if game.Board[y][x] >= 0 {
+				status[y][x] = 2
+			}
+			if game.Board[y][x] != playerId {
+				continue
+			}
+			for _, edge := range EDGES {
+				if check := edge.AddXY(x, y); game.InRange(check) {
+					status[check.Y][check.X] = 2
+				}
+			}
+			for _, corner := range CORNERS {
+				if check := corner.AddXY(x, y); game.InRange(check) && status[check.Y][check.X] < 1 {
+					status[check.Y][check.X] = 1
+				}
+			}
+		}
+	}
+	anchors := make([]Coord, 0)
+	for y := range status {
+		for x, st := range status[y] {
+			if st == 1 {
+				anchors = append(anchors, Coord{x, y})
+			}
+		}
+	}
+	return anchors
+}
+
+// CheckPlayer as it was before the bitboards
+func referenceCheckPlayer(game *Game, playerId int) bool {
+	pieces := game.Rules.PieceSet()
+	for i := 0; i < pieces.Len(); i++ {
+		if game.ChessUsed[playerId][i] {
+			continue
+		}
+		for _, must := range referenceAnchorCells(game, playerId) {
+			for _, rotation := range pieces.distinct[i] {
+				for _, grid := range pieces.rotated[i][rotation].Grids {
+					pos := must.Sub(grid)
+					if game.InRange(pos) && referenceTryInsert(game, i, rotation, pos, playerId, false) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestCheckPlayerMatchesReference(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		for playRandomMoves(game, r, rules.NPlayers); game.ActivePlayer >= 0; playRandomMoves(game, r, 1) {
+			for p := 0; p < rules.NPlayers; p++ {
+				if got, want := game.CheckPlayer(p), referenceCheckPlayer(game, p); got != want {
+					t.Fatalf("%s: player %d can move: got %v, want %v", game.MarshalPosition(), p+1, got, want)
+				}
+			}
+		}
+	}
+}
+
+// A classic game in its middle, where checks are the most expensive
+func benchmarkGame() *Game {
+	game := NewGame(RULES_CLASSIC)
+	playRandomMoves(game, rand.New(rand.NewSource(1)), 40)
+	return game
+}
+
+func BenchmarkCheckPlayer(b *testing.B) {
+	game := benchmarkGame()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		game.CheckPlayer(i % game.Rules.NPlayers)
+	}
+}
+
+func BenchmarkFindLostPlayers(b *testing.B) {
+	game := benchmarkGame()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		game.FindLostPlayers()
+	}
+}
+
+// The same checks walking the board array, to compare with the ones above
+func BenchmarkCheckPlayerReference(b *testing.B) {
+	game := benchmarkGame()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		referenceCheckPlayer(game, i%game.Rules.NPlayers)
+	}
+}
+
+func BenchmarkFindLostPlayersReference(b *testing.B) {
+	game := benchmarkGame()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for p := 0; p < game.Rules.NPlayers; p++ {
+			referenceCheckPlayer(game, p)
+		}
+	}
+}
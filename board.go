@@ -1,8 +1,12 @@
 package squares
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 const (
+	// Dimensions of the classic board, see RULES_CLASSIC
 	BOARD_SIZE   = 21
 	BOARD_WIDTH  = BOARD_SIZE
 	BOARD_HEIGHT = BOARD_SIZE
@@ -11,27 +15,86 @@ const (
 	NPLAYERS = 4 // max players
 )
 
-// The state of a game board
+// The state of a game board.
+// A Game isn't safe for concurrent use, not even for reading: GetLostPlayers
+// caches its result in LostPlayers. Hand out a Clone or a Snapshot instead.
 type Game struct {
+	Rules Rules `json:"rules"`
+
 	// Board[y][x] is the grid at Coord(x, y)
-	Board     [BOARD_HEIGHT][BOARD_WIDTH]int `json:"board"`
-	ChessUsed [NPLAYERS][NSHAPES]bool        `json:"chess_used"`
+	// Only modify through Insert, it's mirrored in the bitboards below
+	Board     [][]int  `json:"board"`
+	ChessUsed [][]bool `json:"chess_used"`
+	LastShape []int    `json:"last_shape"` // Most recently placed shape, -1 = none
 
 	ActivePlayer int  `json:"active_player"` // Who's next, -1 = game over
 	FirstRound   bool `json:"first_round"`
 	LostPlayers  int  `json:"lost_players"` // Cached value from GetLostPlayers()
+
+	History []Move `json:"history"` // All moves made so far, in order
+	redo    []Move // Moves taken back by Undo, last one first to be redone
+	undo    []undoState
+
+	listeners  []Listener
+	eliminated int // Lost players already announced by AfterMove
+
+	// Bitboards maintained by Insert and rebuilt from Board when loaded
+	cellHash  uint64 // Zobrist hash of the occupied cells, see Hash
+	occupied  Bitboard
+	forbidden [NPLAYERS]Bitboard // Occupied or edge-adjacent to own pieces
+	anchors   [NPLAYERS]Bitboard // Free and diagonally adjacent to own pieces
+}
+
+// What Insert saves for Undo, which rebuilds it from Board if it's missing
+type undoState struct {
+	moves       int // Length of History before the move
+	cellHash    uint64
+	occupied    Bitboard
+	forbidden   [NPLAYERS]Bitboard
+	anchors     [NPLAYERS]Bitboard
+	lostPlayers int
+	eliminated  int
 }
 
 /********
  * Game *
  ********/
 
-func NewGame() *Game {
-	game := &Game{}
+// Start a new game, rules must be valid (see Rules.Validate)
+func NewGame(rules Rules) *Game {
+	game := &Game{Rules: rules}
 	game.Reset()
 	return game
 }
 
+// Deep copy of the game state that can be modified independently, e.g. by a
+// search running in another goroutine. Listeners aren't copied.
+// The board and piece lists are copied into one allocation each, and Rules is
+// shared as it's never modified.
+func (game *Game) Clone() *Game {
+	clone := *game
+	cells := make([]int, game.Rules.Width*game.Rules.Height)
+	clone.Board = make([][]int, len(game.Board))
+	for y, row := range game.Board {
+		clone.Board[y] = cells[y*game.Rules.Width : (y+1)*game.Rules.Width : (y+1)*game.Rules.Width]
+		copy(clone.Board[y], row)
+	}
+	n := game.Rules.PieceSet().Len()
+	used := make([]bool, len(game.ChessUsed)*n)
+	clone.ChessUsed = make([][]bool, len(game.ChessUsed))
+	for p, row := range game.ChessUsed {
+		clone.ChessUsed[p] = used[p*n : (p+1)*n : (p+1)*n]
+		copy(clone.ChessUsed[p], row)
+	}
+	clone.LastShape = append([]int(nil), game.LastShape...)
+	clone.History = make([]Move, len(game.History))
+	copy(clone.History, game.History)
+	clone.redo = append([]Move(nil), game.redo...)
+	clone.undo = nil // Undo past the start of the clone rebuilds the bitboards
+	clone.listeners = nil
+	return &clone
+}
+
 func (game *Game) At(x, y int) int {
 	return game.Board[y][x]
 }
@@ -42,176 +105,276 @@ func (game *Game) GetUsed(playerId, shapeId int) bool {
 
 // was Squares::init in the original C++ version
 func (game *Game) Reset() {
-	game.ActivePlayer = 0
+	game.ActivePlayer = game.Rules.TurnOrder[0]
 	game.FirstRound = true
 	game.LostPlayers = 0
 
-	for i := 0; i < BOARD_HEIGHT; i++ {
-		for j := 0; j < BOARD_WIDTH; j++ {
+	game.Board = make([][]int, game.Rules.Height)
+	for i := range game.Board {
+		game.Board[i] = make([]int, game.Rules.Width)
+		for j := range game.Board[i] {
 			game.Board[i][j] = -1
 		}
 	}
-	for p := 0; p < len(game.ChessUsed); p++ {
-		for i := 0; i < len(game.ChessUsed[p]); i++ {
-			game.ChessUsed[p][i] = false
+	game.ChessUsed = make([][]bool, game.Rules.NPlayers)
+	game.LastShape = make([]int, game.Rules.NPlayers)
+	for p := range game.ChessUsed {
+		game.ChessUsed[p] = make([]bool, game.Rules.PieceSet().Len())
+		game.LastShape[p] = -1
+	}
+	game.History = make([]Move, 0)
+	game.redo = nil
+	game.undo = nil
+	game.eliminated = 0
+	game.rebuildBitboards()
+}
+
+// Restore the bitboards after Board has been replaced, e.g. from JSON
+func (game *Game) rebuildBitboards() {
+	game.cellHash = 0
+	game.occupied = Bitboard{}
+	for p := 0; p < NPLAYERS; p++ {
+		game.forbidden[p] = Bitboard{}
+		game.anchors[p] = Bitboard{}
+	}
+	for y := 0; y < game.Rules.Height; y++ {
+		for x := 0; x < game.Rules.Width; x++ {
+			if game.Board[y][x] >= 0 {
+				game.markCell(Coord{x, y}, game.Board[y][x])
+			}
 		}
 	}
+	game.pruneAnchors()
 }
 
-func (game *Game) TryInsert(shapeId, rotation int, pos Coord, playerId int, firstRound bool) bool {
-	if game.ChessUsed[playerId][shapeId] {
-		return false
+// Update the bitboards for a newly occupied cell
+func (game *Game) markCell(c Coord, playerId int) {
+	game.cellHash ^= zobristCells[playerId][game.CellIndex(c)]
+	game.occupied.Set(game.CellIndex(c))
+	for p := 0; p < game.Rules.NPlayers; p++ {
+		game.forbidden[p].Set(game.CellIndex(c))
+	}
+	for _, edge := range EDGES {
+		if check := c.Add(edge); game.InRange(check) {
+			game.forbidden[playerId].Set(game.CellIndex(check))
+		}
+	}
+	for _, corner := range CORNERS {
+		if check := c.Add(corner); game.InRange(check) {
+			game.anchors[playerId].Set(game.CellIndex(check))
+		}
+	}
+}
+
+// Drop anchors that have become occupied or edge-adjacent
+func (game *Game) pruneAnchors() {
+	for p := 0; p < game.Rules.NPlayers; p++ {
+		game.anchors[p].AndNot(&game.forbidden[p])
 	}
-	canPlace := false
-	shape := GetShape(shapeId, rotation)
+}
 
-	if firstRound {
-		corner := Coord{0, 0}
-		switch playerId {
-		case 1:
-			corner.X = BOARD_WIDTH - 1
-		case 3:
-			corner.Y = BOARD_HEIGHT - 1
-		case 2:
-			corner.X = BOARD_WIDTH - 1
-			corner.Y = BOARD_HEIGHT - 1
+func (game *Game) UnmarshalJSON(data []byte) error {
+	type plainGame Game // without methods, to avoid recursion
+
+	// Decode into fresh rules, so the slices of a predefined variant the game
+	// may have been started with are never written to
+	game.Rules = Rules{}
+	game.LastShape = nil
+	if err := json.Unmarshal(data, (*plainGame)(game)); err != nil {
+		return err
+	}
+	var keys struct {
+		Rules json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	if keys.Rules == nil {
+		// Not sent by older versions
+		game.Rules = RULES_CLASSIC
+		game.Rules.Starts = append([]Coord(nil), RULES_CLASSIC.Starts...)
+		game.Rules.TurnOrder = append([]int(nil), RULES_CLASSIC.TurnOrder...)
+	}
+
+	if err := game.Rules.Validate(); err != nil {
+		return err
+	}
+	if len(game.Board) != game.Rules.Height {
+		return fmt.Errorf("expected %d board rows, got %d", game.Rules.Height, len(game.Board))
+	}
+	for _, row := range game.Board {
+		if len(row) != game.Rules.Width {
+			return fmt.Errorf("expected %d board columns, got %d", game.Rules.Width, len(row))
 		}
-		for _, grid := range shape.Grids {
-			pos := pos.Add(grid)
-			if !InRange(pos) {
-				return false
-			}
-			if pos.Equals(corner) {
-				canPlace = true
-			}
+	}
+	if len(game.ChessUsed) != game.Rules.NPlayers {
+		return fmt.Errorf("expected %d players in chess_used, got %d", game.Rules.NPlayers, len(game.ChessUsed))
+	}
+	for _, used := range game.ChessUsed {
+		if len(used) != game.Rules.PieceSet().Len() {
+			return fmt.Errorf("expected %d shapes in chess_used, got %d", game.Rules.PieceSet().Len(), len(used))
 		}
-	} else {
-		for i := range shape.Grids {
-			shape.Grids[i] = shape.Grids[i].Add(pos)
-			if !InRange(shape.Grids[i]) {
-				// out of bounds
-				return false
-			}
-			if game.Board[shape.Grids[i].Y][shape.Grids[i].X] > 0 {
-				// already occupied
-				return false
-			}
+	}
+	if game.LastShape == nil {
+		game.LastShape = make([]int, game.Rules.NPlayers)
+		for p := range game.LastShape {
+			game.LastShape[p] = -1
 		}
-		for _, grid := range shape.Grids {
-			// Edge rule: No adjacent pieces from the same player
-			for _, edge := range EDGES {
-				check := grid.Add(edge)
-				if InRange(check) && game.Board[check.Y][check.X] == playerId {
-					return false
-				}
-			}
-			// Corner rule: One corner must be from the same player
-			for _, corner := range CORNERS {
-				check := grid.Add(corner)
-				if InRange(check) && game.Board[check.Y][check.X] == playerId {
-					canPlace = true
-					break
-				}
+	} else if len(game.LastShape) != game.Rules.NPlayers {
+		return fmt.Errorf("expected %d players in last_shape, got %d", game.Rules.NPlayers, len(game.LastShape))
+	}
+
+	// Values used as indices, check them before the bitboards are rebuilt
+	for y, row := range game.Board {
+		for x, cell := range row {
+			if cell < -1 || cell >= game.Rules.NPlayers {
+				return fmt.Errorf("invalid player %d at %s", cell, FormatSquare(Coord{x, y}))
 			}
 		}
 	}
-	return canPlace
+	for p, last := range game.LastShape {
+		if last < -1 || last >= game.Rules.PieceSet().Len() {
+			return fmt.Errorf("invalid last shape %d of player %d", last, p+1)
+		}
+	}
+	if game.ActivePlayer < -1 || game.ActivePlayer >= game.Rules.NPlayers {
+		return fmt.Errorf("invalid active player %d", game.ActivePlayer)
+	}
+	for i, m := range game.History {
+		if !game.moveInRange(m) {
+			return fmt.Errorf("move %d in history out of range", i+1)
+		}
+	}
+	game.redo = nil
+	game.undo = nil
+	game.rebuildBitboards()
+	game.eliminated = game.GetLostPlayers()
+	return nil
+}
+
+func (game *Game) TryInsert(shapeId, rotation int, pos Coord, playerId int, firstRound bool) bool {
+	return game.CheckInsert(shapeId, rotation, pos, playerId, firstRound) == nil
+}
+
+// Like TryInsert, but return a MoveError explaining why the piece can't be placed
+func (game *Game) CheckInsert(shapeId, rotation int, pos Coord, playerId int, firstRound bool) error {
+	pieces := game.Rules.PieceSet()
+	if shapeId < 0 || shapeId >= pieces.Len() {
+		return ERR_INVALID_SHAPE
+	}
+	if rotation < 0 || rotation >= NROTATIONS {
+		return ERR_INVALID_ROTATION
+	}
+	if playerId < 0 || playerId >= game.Rules.NPlayers {
+		return ERR_INVALID_PLAYER
+	}
+	if game.ChessUsed[playerId][shapeId] {
+		return ERR_PIECE_USED
+	}
+	var mask Bitboard
+	for _, grid := range pieces.rotated[shapeId][rotation].Grids {
+		grid = grid.Add(pos)
+		if !game.InRange(grid) {
+			return ERR_OUT_OF_BOUNDS
+		}
+		mask.Set(game.CellIndex(grid))
+	}
+
+	if mask.Intersects(&game.occupied) {
+		return ERR_OVERLAP
+	}
+	if firstRound {
+		if !mask.Test(game.CellIndex(game.Rules.Starts[playerId])) {
+			return ERR_MISSES_START
+		}
+		return nil
+	}
+	// Edge rule: No adjacent pieces from the same player
+	if mask.Intersects(&game.forbidden[playerId]) {
+		return ERR_EDGE_CONTACT
+	}
+	// Corner rule: One corner must be from the same player
+	if !mask.Intersects(&game.anchors[playerId]) {
+		return ERR_NO_CORNER_CONTACT
+	}
+	return nil
 }
 
 func (game *Game) Insert(shapeId, rotation int, pos Coord, playerId int) {
-	shape := GetShape(shapeId, rotation)
-	for _, grid := range shape.Grids {
+	game.undo = append(game.undo, undoState{
+		len(game.History), game.cellHash, game.occupied, game.forbidden, game.anchors, game.LostPlayers, game.eliminated,
+	})
+	for _, grid := range game.Rules.PieceSet().rotated[shapeId][rotation].Grids {
 		grid = grid.Add(pos)
 		game.Board[grid.Y][grid.X] = playerId
+		game.markCell(grid, playerId)
 	}
+	game.pruneAnchors()
 	game.ChessUsed[playerId][shapeId] = true
+	game.LastShape[playerId] = shapeId
+	game.History = append(game.History, Move{shapeId, rotation, pos, playerId})
+	game.redo = nil
 
 	game.LostPlayers = -1 // so it's calculated the next time GetLostPlayers() is called
+	game.emit(MovePlacedEvent{game.History[len(game.History)-1], game.Rules.PieceSet()})
 }
 
 func (game *Game) AfterMove() bool {
 	if !game.FirstRound {
-		if lp := game.GetLostPlayers(); lp != 0 {
-			for i := 0; i < NPLAYERS; i++ {
-				if lp&(1<<i) != 0 {
-					if !game.IsAnyPlayerAlive() {
-						fmt.Printf("Player %d won!\n", i+1)
-					} else {
-						fmt.Printf("Player %d lost!\n", i+1)
-					}
-				}
+		lp := game.GetLostPlayers()
+		for i := 0; i < game.Rules.NPlayers; i++ {
+			if lp&^game.eliminated&(1<<i) != 0 {
+				game.emit(PlayerEliminatedEvent{i})
 			}
 		}
-	} else if game.ActivePlayer == NPLAYERS-1 {
+		game.eliminated = lp
+	} else if game.Rules.IsLastPlayer(game.ActivePlayer) {
 		game.FirstRound = false
+		game.emit(FirstRoundOverEvent{})
 	}
 
-	activePlayer := (game.ActivePlayer + 1) % NPLAYERS
+	activePlayer := game.Rules.NextPlayer(game.ActivePlayer)
 	if game.GetLostPlayers() != 0 {
 		if !game.IsAnyPlayerAlive() {
 			game.ActivePlayer = -1
+			game.emit(GameOverEvent{game.Standings(SCORING_ADVANCED)})
 			return false
 		}
-		for _ = activePlayer; game.LostPlayers&(1<<activePlayer) != 0; activePlayer = (activePlayer + 1) % NPLAYERS {
+		for game.LostPlayers&(1<<activePlayer) != 0 {
+			activePlayer = game.Rules.NextPlayer(activePlayer)
 		}
 	}
 	game.ActivePlayer = activePlayer
+	game.emit(TurnChangedEvent{activePlayer})
 	return true
 }
 
-// Check if a player has any valid move available
-func (game *Game) CheckPlayer(playerId int) bool {
-	/*Board status
-	 * 0: This cell is not adjacent to any existing pieces
-	 * 1: This cell is diagonally adjacent to an existing piece
-	 * 2: This cell is orthogonally adjacent to, or already covered by, an existing piece
-	 */
-	var boardStatus [BOARD_HEIGHT][BOARD_WIDTH]int
-	for y := 0; y < BOARD_HEIGHT; y++ {
-		for x := 0; x < BOARD_WIDTH; x++ {
-			// Mark occupied cells
-			if game.Board[y][x] >= 0 {
-				boardStatus[y][x] = 2
-			}
-			// Calculate adjacency only for same-color cells
-			if game.Board[y][x] != playerId {
-				continue
-			}
-			for _, edge := range EDGES {
-				check := edge.AddXY(x, y)
-				if InRange(check) {
-					boardStatus[check.Y][check.X] = 2
-				}
-			}
-			for _, corner := range CORNERS {
-				check := corner.AddXY(x, y)
-				if InRange(check) && boardStatus[check.Y][check.X] < 1 {
-					boardStatus[check.Y][check.X] = 1
-				}
-			}
-		}
+// Find all cells that a player's next piece may use to touch their existing pieces.
+// Each legal placement covers at least one of these cells.
+func (game *Game) anchorCells(playerId int) []Coord {
+	indices := game.anchors[playerId].Indices()
+	cells := make([]Coord, len(indices))
+	for i, index := range indices {
+		cells[i] = game.CellCoord(index)
 	}
+	return cells
+}
 
-	musts := make([]Coord, 0)
-	for y := 0; y < BOARD_HEIGHT; y++ {
-		for x := 0; x < BOARD_WIDTH; x++ {
-			if boardStatus[y][x] == 1 {
-				musts = append(musts, Coord{x, y})
-			}
-		}
-	}
+// Check if a player has any valid move available
+func (game *Game) CheckPlayer(playerId int) bool {
+	musts := game.anchorCells(playerId)
+	pieces := game.Rules.PieceSet()
 
 	// Enumerate all remaining pieces over all "must cover" cells
-	for i := 0; i < NSHAPES; i++ {
+	for i := 0; i < pieces.Len(); i++ {
 		if game.ChessUsed[playerId][i] {
 			continue
 		}
 		for _, must := range musts {
-			for rotation := 0; rotation < NROTATIONS; rotation++ {
-				shape := GetShape(i, rotation)
-				for _, grid := range shape.Grids {
+			for _, rotation := range pieces.distinct[i] {
+				for _, grid := range pieces.rotated[i][rotation].Grids {
 					pos := must.Sub(grid)
-					if InRange(pos) && game.TryInsert(i, rotation, pos, playerId, false) {
+					if game.InRange(pos) && game.TryInsert(i, rotation, pos, playerId, false) {
 						return true
 					}
 				}
@@ -227,7 +390,7 @@ func (game *Game) FindLostPlayers() int {
 	}
 
 	ret := 0
-	for i := 0; i < NPLAYERS; i++ {
+	for i := 0; i < game.Rules.NPlayers; i++ {
 		if !game.CheckPlayer(i) {
 			ret |= 1 << i
 		}
@@ -244,13 +407,22 @@ func (game *Game) GetLostPlayers() int {
 }
 
 func (game *Game) IsAnyPlayerAlive() bool {
-	return game.GetLostPlayers() != (1<<NPLAYERS)-1
+	return game.GetLostPlayers() != (1<<game.Rules.NPlayers)-1
 }
 
 /**********************************
  * Game-related utility functions *
  **********************************/
 
-func InRange(c Coord) bool {
-	return c.X >= 0 && c.X < BOARD_WIDTH && c.Y >= 0 && c.Y < BOARD_HEIGHT
+func (game *Game) InRange(c Coord) bool {
+	return game.Rules.InRange(c)
+}
+
+// Bitboard index of a cell, row by row
+func (game *Game) CellIndex(c Coord) int {
+	return c.Y*game.Rules.Width + c.X
+}
+
+func (game *Game) CellCoord(i int) Coord {
+	return Coord{i % game.Rules.Width, i / game.Rules.Width}
 }
@@ -0,0 +1,110 @@
+package squares
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// JSON of a game a few moves in, decoded into generic values to be tampered with
+func gameJSON(t *testing.T, rules Rules) map[string]any {
+	game := NewGame(rules)
+	playRandomMoves(game, rand.New(rand.NewSource(1)), 6)
+	data, err := json.Marshal(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestGameJSONRoundTrip(t *testing.T) {
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		playRandomMoves(game, rand.New(rand.NewSource(1)), 10)
+		data, err := json.Marshal(game)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var loaded Game
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			t.Fatalf("%s: %v", rules.Name, err)
+		}
+		if got, want := stateOf(&loaded), stateOf(game); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: loaded\n%+v\nwant\n%+v", rules.Name, got, want)
+		}
+		if !reflect.DeepEqual(loaded.History, game.History) {
+			t.Errorf("%s: loaded history %v, want %v", rules.Name, loaded.History, game.History)
+		}
+	}
+}
+
+// Games from before the rules were sent load as classic, without sharing its slices
+func TestGameJSONWithoutRules(t *testing.T) {
+	m := gameJSON(t, RULES_CLASSIC)
+	delete(m, "rules")
+	data, _ := json.Marshal(m)
+	game := NewGame(RULES_DUO)
+	if err := json.Unmarshal(data, game); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(game.Rules, RULES_CLASSIC) {
+		t.Errorf("got rules %+v, want classic", game.Rules)
+	}
+	game.Rules.Starts[0] = Coord{5, 5}
+	game.Rules.TurnOrder[0] = 3
+	if RULES_CLASSIC.Starts[0] != (Coord{0, 0}) || RULES_CLASSIC.TurnOrder[0] != 0 {
+		t.Errorf("RULES_CLASSIC changed to %+v", RULES_CLASSIC)
+	}
+}
+
+func TestGameJSONDoesntChangeVariants(t *testing.T) {
+	data, _ := json.Marshal(NewGame(RULES_DUO))
+	game := NewGame(RULES_CLASSIC)
+	if err := json.Unmarshal(data, game); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(VARIANTS[0], RULES_CLASSIC) || RULES_CLASSIC.Starts[1] != (Coord{20, 0}) {
+		t.Errorf("RULES_CLASSIC changed to %+v", RULES_CLASSIC)
+	}
+}
+
+func TestGameJSONErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(m map[string]any)
+	}{
+		{"player in a cell", func(m map[string]any) { m["board"].([]any)[3].([]any)[5] = 7 }},
+		{"negative cell", func(m map[string]any) { m["board"].([]any)[0].([]any)[0] = -2 }},
+		{"missing row", func(m map[string]any) { m["board"] = m["board"].([]any)[1:] }},
+		{"short row", func(m map[string]any) { m["board"].([]any)[2] = m["board"].([]any)[2].([]any)[1:] }},
+		{"missing player in chess_used", func(m map[string]any) { m["chess_used"] = m["chess_used"].([]any)[1:] }},
+		{"last shape", func(m map[string]any) { m["last_shape"].([]any)[1] = 21 }},
+		{"negative last shape", func(m map[string]any) { m["last_shape"].([]any)[1] = -2 }},
+		{"active player", func(m map[string]any) { m["active_player"] = 4 }},
+		{"negative active player", func(m map[string]any) { m["active_player"] = -3 }},
+		{"history shape", func(m map[string]any) { m["history"].([]any)[0].(map[string]any)["shape"] = 30 }},
+		{"history rotation", func(m map[string]any) { m["history"].([]any)[0].(map[string]any)["rotation"] = 8 }},
+		{"history player", func(m map[string]any) { m["history"].([]any)[0].(map[string]any)["player_id"] = -1 }},
+		{"history position", func(m map[string]any) {
+			m["history"].([]any)[0].(map[string]any)["pos"] = map[string]int{"X": 30, "Y": 0}
+		}},
+		{"rules", func(m map[string]any) { m["rules"].(map[string]any)["players"] = 5 }},
+	}
+	for _, tt := range tests {
+		m := gameJSON(t, RULES_CLASSIC)
+		tt.tamper(m)
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var game Game
+		if err := json.Unmarshal(data, &game); err == nil {
+			t.Errorf("%s: loaded without an error", tt.name)
+		}
+	}
+}
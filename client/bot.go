@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iBug/Squares-go/ai"
+)
+
+// Search time of the bots that would otherwise think for too long
+const BOT_THINK_TIME = 2 * time.Second
+
+// Kinds of server-side bots, in AddBotsReq
+var BOT_KINDS = []string{"random", "greedy", "mcts", "alphabeta"}
+
+func newBot(kind string) (ai.Player, error) {
+	seed := time.Now().UnixNano()
+	switch kind {
+	case "random":
+		return ai.NewRandomPlayer(seed), nil
+	case "greedy", "":
+		return ai.NewGreedyPlayer(seed), nil
+	case "mcts":
+		p := ai.NewMCTSPlayer(seed)
+		p.Iterations, p.TimeLimit = 0, BOT_THINK_TIME
+		return p, nil
+	case "alphabeta":
+		p := ai.NewAlphaBetaPlayer()
+		p.TimeLimit = BOT_THINK_TIME
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown bot kind %q, expected one of %s", kind, strings.Join(BOT_KINDS, ", "))
+}
+
+// A lobby seat taken by a bot, it has no connection so Send does nothing
+func newBotClient(kind string) (*ClientInfo, error) {
+	bot, err := newBot(kind)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		kind = "greedy"
+	}
+	return &ClientInfo{name: fmt.Sprintf("Bot (%s)", kind), bot: bot, botKind: kind}, nil
+}
+
+// Let the bot on the active seat pick a move in the background. The move is
+// handed back to the room as a MoveReq, so it is checked like any other.
+func (room *Room) startBotTurn() {
+	if !room.gameOngoing || room.game.ActivePlayer < 0 {
+		return
+	}
+	ci := room.lobby[room.game.ActivePlayer]
+	if ci == nil || ci.bot == nil {
+		return
+	}
+	game, playerId := room.game.Clone(), room.game.ActivePlayer
+	go func() {
+		start := time.Now()
+		move, ok := ci.bot.ChooseMove(game, playerId)
+		if !ok {
+			room.logf("%s found no move\n", ci.Name())
+			return
+		}
+		if wait := fBotDelay - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+		room.botCh <- ClientMessage{ci, MoveReq{
+			ShapeId:  move.ShapeId,
+			Pos:      [2]int{move.Pos.X, move.Pos.Y},
+			Rotation: move.Rotation,
+		}}
+	}()
+}
+
+// Fill up to count empty seats with bots, all of them if count is 0
+func (room *Room) addBots(kind string, count int) error {
+	for added := 0; (count <= 0 || added < count) && room.seated() < room.game.Rules.NPlayers; added++ {
+		ci, err := newBotClient(kind)
+		if err != nil {
+			return err
+		}
+		num := room.addClientToLobby(ci)
+		room.logf("Client[%d] is a %s bot\n", num, ci.botKind)
+	}
+	return nil
+}
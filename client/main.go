@@ -6,14 +6,17 @@ import (
 	"log"
 	"math"
 	"net"
+	"os"
+	"strings"
+	"time"
 
 	squares "github.com/iBug/Squares-go"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 const (
-	GRID_WIDTH         = squares.BOARD_WIDTH
-	GRID_HEIGHT        = squares.BOARD_HEIGHT
+	GRID_WIDTH         = squares.BOARD_WIDTH  // Board area size in cells of GRID_CELL_SIZE,
+	GRID_HEIGHT        = squares.BOARD_HEIGHT // other boards are scaled to fit, see gridCellSize
 	GRID_CELL_SIZE     = 36
 	SELECTOR_WIDTH     = 16
 	SELECTOR_HEIGHT    = squares.BOARD_HEIGHT
@@ -32,13 +35,21 @@ const (
 )
 
 var (
+	// Selector layout of the standard set, see selectorLayout
 	SELECTOR_POS = []squares.Coord{{1, 1}, {1, 3}, {1, 5}, {1, 7}, {1, 10}, {1, 12}, {1, 15}, {1, 18}, {6, 1}, {10, 1}, {6, 4}, {6, 7}, {6, 10}, {6, 13}, {6, 17}, {12, 3}, {12, 10}, {12, 14}, {9, 15}, {12, 18}, {12, 7}}
 )
 
 var (
-	game         = squares.NewGame()
+	game         = squares.NewGame(squares.RULES_CLASSIC)
 	clientId     = 0
 	clientPlayer = 0 // which player this client represents
+	clientRoom   = 0 // room on the server, 0 for the default one
+	clientReady  = false
+	playerNames  []string // from the server, see PlayerName
+
+	serverCapabilities []string
+	serverHello        bool // got the Hello of the current connection
+	legacyServer       bool // server from before the handshake
 
 	// Global event channel, as a complement for sdl.PushEvent
 	chEvent = make(chan any, 8)
@@ -47,6 +58,21 @@ var (
 	fIsServer         = false
 	fLocalMultiplayer = false
 	fUseDarkTheme     = false
+	fVariant          = ""
+	fRecordDir        = ""
+	fLoadRecord       = ""
+	fLogBoard         = false
+	fPosition         = ""
+	fPieces           = ""
+	fCreateRoom       = ""
+	fSpectate         = false
+	fName             = ""
+	fBots             = ""
+	fBotDelay         = time.Duration(0)
+
+	// Selector layout computed for a non-standard piece set
+	selectorPieces *squares.PieceSet
+	selectorPos    []squares.Coord
 )
 
 type ConnectionLost struct {
@@ -58,8 +84,48 @@ func parseFlags() {
 	flag.BoolVar(&fUseDarkTheme, "d", false, "use dark theme")
 	flag.BoolVar(&fIsServer, "s", false, "run as server")
 	flag.IntVar(&clientId, "i", 0, "client id (for reconnection)")
+	flag.StringVar(&fVariant, "v", squares.RULES_CLASSIC.Name, "game variant (local game, server or new room)")
+	flag.StringVar(&fRecordDir, "r", "", "directory to save game records in (server)")
+	flag.StringVar(&fLoadRecord, "l", "", "game record to continue from (local game)")
+	flag.BoolVar(&fLogBoard, "b", false, "log the board after every move (server)")
+	flag.StringVar(&fPosition, "p", "", "position string to start from (local game)")
+	flag.StringVar(&fPieces, "P", "", "piece set file (local game or server)")
+	flag.IntVar(&clientRoom, "j", 0, "room to join on the server")
+	flag.StringVar(&fCreateRoom, "c", "", "name of a new room to open on the server")
+	flag.BoolVar(&fSpectate, "w", false, "watch a game on the server without playing")
+	flag.StringVar(&fName, "n", "", "name shown to other players")
+	flag.StringVar(&fBots, "B", "greedy", "kind of bots the 'b' key fills empty seats with ("+strings.Join(BOT_KINDS, ", ")+")")
+	flag.DurationVar(&fBotDelay, "t", 500*time.Millisecond, "minimum time bots take for a move (server)")
 	flag.Parse()
 
+	rules, ok := squares.GetRules(fVariant)
+	if !ok {
+		log.Fatalf("Unknown variant: %s\n", fVariant)
+	}
+	if fPieces != "" {
+		pieces, err := squares.LoadPieceSet(fPieces)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// So records and positions can refer to it
+		if err := squares.RegisterPieceSet(pieces); err != nil {
+			log.Fatal(err)
+		}
+		rules.Pieces = pieces
+	}
+	game = squares.NewGame(rules)
+	if fLoadRecord != "" {
+		loadRecord(fLoadRecord)
+	} else if fPosition != "" {
+		var err error
+		if game, err = squares.ParsePosition(fPosition); err != nil {
+			log.Fatal(err)
+		}
+		if game.ActivePlayer >= 0 {
+			clientPlayer = game.ActivePlayer
+		}
+	}
+
 	fLocalMultiplayer = fServerAddr == ""
 
 	if fUseDarkTheme {
@@ -67,12 +133,62 @@ func parseFlags() {
 	}
 }
 
+func loadRecord(filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	rec, err := squares.ReadRecord(f)
+	if err != nil {
+		log.Fatalf("%s: %s\n", filename, err)
+	}
+	if game, err = rec.Replay(); err != nil {
+		log.Fatalf("%s: %s\n", filename, err)
+	}
+	if game.ActivePlayer >= 0 {
+		clientPlayer = game.ActivePlayer
+	}
+}
+
+// Where each piece is shown in the selector, in selector cells
+func selectorLayout() []squares.Coord {
+	pieces := game.Rules.PieceSet()
+	if pieces == squares.PIECES_STANDARD {
+		return SELECTOR_POS
+	}
+	if pieces != selectorPieces {
+		selectorPieces, selectorPos = pieces, layoutSelector(pieces)
+	}
+	return selectorPos
+}
+
+// Place the pieces left to right in rows, one cell apart
+func layoutSelector(pieces *squares.PieceSet) []squares.Coord {
+	pos := make([]squares.Coord, pieces.Len())
+	x, y, rowHeight := 1, 1, 0
+	for i, shape := range pieces.Shapes {
+		if x > 1 && x+shape.Width >= SELECTOR_WIDTH {
+			x, y, rowHeight = 1, y+rowHeight+1, 0
+		}
+		pos[i] = squares.Coord{x, y}
+		x += shape.Width + 1
+		if shape.Height > rowHeight {
+			rowHeight = shape.Height
+		}
+	}
+	if y+rowHeight > SELECTOR_HEIGHT {
+		log.Printf("Piece set %s doesn't fit in the selector\n", pieces.Name)
+	}
+	return pos
+}
+
 func getSelection(x, y int) int {
-	for i := 0; i < squares.NSHAPES; i++ {
-		shape := squares.GetShape(i, 0)
-		startX := SELECTOR_POS[i].X*SELECTOR_CELL_SIZE + BOARD_AREA_WIDTH
+	layout := selectorLayout()
+	for i, shape := range game.Rules.PieceSet().Shapes {
+		startX := layout[i].X*SELECTOR_CELL_SIZE + BOARD_AREA_WIDTH
 		endX := startX + shape.Width*SELECTOR_CELL_SIZE
-		startY := SELECTOR_POS[i].Y * SELECTOR_CELL_SIZE
+		startY := layout[i].Y * SELECTOR_CELL_SIZE
 		endY := startY + shape.Height*SELECTOR_CELL_SIZE
 		if x >= startX && x < endX && y >= startY && y < endY {
 			return i
@@ -82,12 +198,12 @@ func getSelection(x, y int) int {
 }
 
 func getRotation(x, y, shapeId int) int {
-	rotations := squares.AvailableRotations(shapeId)
+	rotations := game.Rules.PieceSet().AvailableRotations(shapeId)
 	for i := 0; i < squares.NROTATIONS; i++ {
 		if rotations&(1<<i) == 0 {
 			continue
 		}
-		shape := squares.GetShape(shapeId, i)
+		shape := game.Rules.PieceSet().Shape(shapeId, i)
 		startX := (i%4*ROTATOR_WIDTH+2)*ROTATOR_CELL_SIZE + BOARD_AREA_WIDTH
 		endX := startX + shape.Width*ROTATOR_CELL_SIZE
 		startY := WINDOW_HEIGHT - ((2-i/4)*ROTATOR_WIDTH+1)*ROTATOR_CELL_SIZE
@@ -99,13 +215,30 @@ func getRotation(x, y, shapeId int) int {
 	return -1
 }
 
+// Size of a board cell in pixels, so the board of the current rules fills the board area
+func gridCellSize() int32 {
+	size := int32((BOARD_AREA_WIDTH - 1) / game.Rules.Width)
+	if height := int32((WINDOW_HEIGHT - 1) / game.Rules.Height); height < size {
+		size = height
+	}
+	return size
+}
+
+// Board cell under a point of the window, false if it's off the board
+func gridCellAt(x, y int32) (squares.Coord, bool) {
+	size := gridCellSize()
+	c := squares.Coord{int(x / size), int(y / size)}
+	return c, x >= 0 && y >= 0 && game.InRange(c)
+}
+
 func renderBoard(renderer *sdl.Renderer) {
-	for i := 0; i < squares.BOARD_HEIGHT; i++ {
-		for j := 0; j < squares.BOARD_WIDTH; j++ {
+	size := gridCellSize()
+	for i := 0; i < game.Rules.Height; i++ {
+		for j := 0; j < game.Rules.Width; j++ {
 			if game.At(j, i) >= 0 {
 				gridColor := GRID_CURSOR_COLORS[game.At(j, i)]
 				renderer.SetDrawColor(gridColor.R, gridColor.G, gridColor.B, gridColor.A)
-				rect := sdl.Rect{int32(j * GRID_CELL_SIZE), int32(i * GRID_CELL_SIZE), int32(GRID_CELL_SIZE), int32(GRID_CELL_SIZE)}
+				rect := sdl.Rect{int32(j) * size, int32(i) * size, size, size}
 				renderer.FillRect(&rect)
 			}
 		}
@@ -126,7 +259,7 @@ func setColorForShape(renderer *sdl.Renderer, shapeId int, useGhostColor bool) {
 }
 
 func renderShape(renderer *sdl.Renderer, shapeId, rotation int, topleft sdl.Rect, width, height int) {
-	shape := squares.GetShape(shapeId, rotation)
+	shape := game.Rules.PieceSet().Shape(shapeId, rotation)
 	for i := 0; i < len(shape.Grids); i++ {
 		tmp := topleft
 		tmp.X += int32(shape.Grids[i].X * width)
@@ -136,11 +269,12 @@ func renderShape(renderer *sdl.Renderer, shapeId, rotation int, topleft sdl.Rect
 }
 
 func renderSelector(renderer *sdl.Renderer, clientPlayer, shapeId int) {
-	for i := 0; i < squares.NSHAPES; i++ {
+	layout := selectorLayout()
+	for i := 0; i < game.Rules.PieceSet().Len(); i++ {
 		setColorForShape(renderer, i, i == shapeId)
 		base := sdl.Rect{
-			X: int32(SELECTOR_POS[i].X*SELECTOR_CELL_SIZE + BOARD_AREA_WIDTH),
-			Y: int32(SELECTOR_POS[i].Y * SELECTOR_CELL_SIZE),
+			X: int32(layout[i].X*SELECTOR_CELL_SIZE + BOARD_AREA_WIDTH),
+			Y: int32(layout[i].Y * SELECTOR_CELL_SIZE),
 			W: SELECTOR_CELL_SIZE,
 			H: SELECTOR_CELL_SIZE,
 		}
@@ -149,12 +283,12 @@ func renderSelector(renderer *sdl.Renderer, clientPlayer, shapeId int) {
 }
 
 func renderRotator(renderer *sdl.Renderer, clientPlayer, shapeId, rotation int) {
-	rotations := squares.AvailableRotations(shapeId)
+	rotations := game.Rules.PieceSet().AvailableRotations(shapeId)
 	for i := 0; i < squares.NROTATIONS; i++ {
 		if rotations&(1<<i) == 0 {
 			continue
 		}
-		setColorForShape(renderer, i, i == rotation)
+		setColorForShape(renderer, shapeId, i == rotation)
 		base := sdl.Rect{
 			X: int32((i%4*ROTATOR_WIDTH+2)*ROTATOR_CELL_SIZE + BOARD_AREA_WIDTH),
 			Y: int32(WINDOW_HEIGHT - ((2-i/4)*ROTATOR_WIDTH+1)*ROTATOR_CELL_SIZE),
@@ -167,10 +301,9 @@ func renderRotator(renderer *sdl.Renderer, clientPlayer, shapeId, rotation int)
 
 // was render_ghost() in original C++ code
 func shouldRenderGhost(topleft sdl.Rect, shapeId, rotation int) bool {
-	shape := squares.GetShape(shapeId, rotation)
-	x := int(topleft.X)+shape.Width*GRID_CELL_SIZE <= WINDOW_HEIGHT
-	y := int(topleft.Y)+shape.Height*GRID_CELL_SIZE <= BOARD_AREA_WIDTH
-	return x && y
+	shape := game.Rules.PieceSet().Shape(shapeId, rotation)
+	c, ok := gridCellAt(topleft.X, topleft.Y)
+	return ok && c.X+shape.Width <= game.Rules.Width && c.Y+shape.Height <= game.Rules.Height
 }
 
 func pushSdlEvent(code uint32, windowId uint32, e any) (bool, error) {
@@ -182,6 +315,48 @@ func pushSdlEvent(code uint32, windowId uint32, e any) (bool, error) {
 	})
 }
 
+// Show the player and an optional status message in the window title
+func setTitle(window *sdl.Window, status string) {
+	title := fmt.Sprintf("Squares (%s)", PlayerName(playerNames, clientPlayer))
+	if fSpectate {
+		title = "Squares (Spectating)"
+		if game.ActivePlayer >= 0 {
+			title += fmt.Sprintf(" - %s to move", PlayerName(playerNames, game.ActivePlayer))
+		}
+	}
+	if status != "" {
+		title += " - " + status
+	}
+	window.SetTitle(title)
+}
+
+func showGameOver(window *sdl.Window, standings []squares.Standing) {
+	s := StandingsString(standings, playerNames)
+	log.Printf("Game over!\n%s", s)
+	sdl.ShowSimpleMessageBox(sdl.MESSAGEBOX_INFORMATION, "Game over", s, window)
+}
+
+// Hand the seat to whoever moves next in a hot-seat game
+func localGameListener(window *sdl.Window) squares.Listener {
+	notices := make([]string, 0)
+	return squares.ListenerFunc(func(game *squares.Game, e squares.Event) {
+		switch e := e.(type) {
+		case squares.PlayerEliminatedEvent:
+			log.Println(e)
+			notices = append(notices, e.String())
+		case squares.TurnChangedEvent:
+			clientPlayer = e.PlayerId
+			setTitle(window, strings.Join(notices, ", "))
+			notices = notices[:0]
+		case squares.MoveUndoneEvent:
+			clientPlayer = game.ActivePlayer
+			setTitle(window, "")
+		case squares.GameOverEvent:
+			showGameOver(window, e.Standings)
+		}
+	})
+}
+
 func clientNetThread(conn net.Conn, windowId uint32) {
 	defer conn.Close()
 	for {
@@ -201,7 +376,30 @@ func setupClientNetThread(window *sdl.Window) (net.Conn, error) {
 	}
 	windowID, _ := window.GetID()
 	go clientNetThread(conn, windowID)
-	return conn, SendMsg(conn, ConnectReq{Id: clientId})
+	serverHello = false
+	if !legacyServer {
+		if err := SendMsg(conn, Hello{PROTOCOL_VERSION, MIN_PROTOCOL_VERSION, CAPABILITIES}); err != nil {
+			return conn, err
+		}
+	}
+	if fCreateRoom != "" && clientRoom == 0 && !legacyServer {
+		return conn, SendMsg(conn, RoomCreateReq{Name: fCreateRoom, Variant: variantName(game.Rules), Player: fName})
+	}
+	return conn, SendMsg(conn, connectReq())
+}
+
+// Check if the server takes the messages of a capability, log it if not
+func serverSupports(capability string) bool {
+	if !HasCapability(serverCapabilities, capability) {
+		log.Printf("Server doesn't support %s\n", capability)
+		return false
+	}
+	return true
+}
+
+// Join or rejoin the current room, also used to reload the game
+func connectReq() ConnectReq {
+	return ConnectReq{Id: clientId, Room: clientRoom, Spectate: fSpectate, Name: fName}
 }
 
 func clientMain() {
@@ -216,7 +414,7 @@ func clientMain() {
 	}
 	defer renderer.Destroy()
 	defer window.Destroy()
-	window.SetTitle(fmt.Sprintf("Squares (Player %d)", clientPlayer+1))
+	setTitle(window, "")
 
 	var conn net.Conn
 	if !fLocalMultiplayer {
@@ -227,7 +425,9 @@ func clientMain() {
 	}
 
 	// Initialize data
-	game.Reset()
+	if fLocalMultiplayer {
+		game.AddListener(localGameListener(window))
+	}
 	shapeId := 0
 	rotation := 0
 
@@ -236,16 +436,16 @@ func clientMain() {
 	mouseHover := false
 
 	gridCursor := sdl.Rect{
-		X: (GRID_WIDTH - 1) / 2 * GRID_CELL_SIZE,
-		Y: (GRID_HEIGHT - 1) / 2 * GRID_CELL_SIZE,
-		W: GRID_CELL_SIZE,
-		H: GRID_CELL_SIZE,
+		X: int32(game.Rules.Width-1) / 2 * gridCellSize(),
+		Y: int32(game.Rules.Height-1) / 2 * gridCellSize(),
+		W: gridCellSize(),
+		H: gridCellSize(),
 	}
 	gridCursorGhost := sdl.Rect{
 		X: gridCursor.X,
 		Y: gridCursor.Y,
-		W: GRID_CELL_SIZE,
-		H: GRID_CELL_SIZE,
+		W: gridCellSize(),
+		H: gridCellSize(),
 	}
 
 	nextTime := sdl.GetTicks64()
@@ -258,61 +458,89 @@ func clientMain() {
 				}
 				switch event.Keysym.Sym {
 				case sdl.K_w, sdl.K_UP:
-					gridCursor.Y -= GRID_CELL_SIZE
+					gridCursor.Y -= gridCellSize()
 				case sdl.K_s, sdl.K_DOWN:
-					gridCursor.Y += GRID_CELL_SIZE
+					gridCursor.Y += gridCellSize()
 				case sdl.K_a, sdl.K_LEFT:
-					gridCursor.X -= GRID_CELL_SIZE
+					gridCursor.X -= gridCellSize()
 				case sdl.K_d, sdl.K_RIGHT:
-					gridCursor.X += GRID_CELL_SIZE
+					gridCursor.X += gridCellSize()
 				case sdl.K_q:
-					rotation = squares.GetPrevRotation(shapeId, rotation)
+					rotation = game.Rules.PieceSet().PrevRotation(shapeId, rotation)
 				case sdl.K_e, sdl.K_SPACE:
-					rotation = squares.GetNextRotation(shapeId, rotation)
+					rotation = game.Rules.PieceSet().NextRotation(shapeId, rotation)
 				case sdl.K_r:
 					if !fLocalMultiplayer {
-						SendMsg(conn, ConnectReq{Id: clientId})
+						SendMsg(conn, connectReq())
+					}
+				case sdl.K_p:
+					log.Printf("Position: %s\n", game.MarshalPosition())
+				case sdl.K_l:
+					if !fLocalMultiplayer && serverSupports(CAP_ROOMS) {
+						SendMsg(conn, RoomListReq{})
+					}
+				case sdl.K_b:
+					if !fLocalMultiplayer && serverSupports(CAP_BOTS) {
+						SendMsg(conn, AddBotsReq{Kind: fBots})
+					}
+				case sdl.K_RETURN:
+					if !fLocalMultiplayer && serverSupports(CAP_LOBBY) {
+						SendMsg(conn, ReadyReq{!clientReady})
+					}
+				case sdl.K_g:
+					if !fLocalMultiplayer && serverSupports(CAP_LOBBY) {
+						SendMsg(conn, StartReq{})
+					}
+				case sdl.K_z:
+					if fLocalMultiplayer {
+						game.Undo()
+					}
+				case sdl.K_y:
+					if fLocalMultiplayer {
+						game.Redo()
 					}
 				}
 			case *sdl.MouseWheelEvent:
 				if event.Y > 0 {
 					// Scroll up
-					rotation = squares.GetPrevRotation(shapeId, rotation)
+					rotation = game.Rules.PieceSet().PrevRotation(shapeId, rotation)
 				} else if event.Y < 0 {
 					// Scroll down
-					rotation = squares.GetNextRotation(shapeId, rotation)
+					rotation = game.Rules.PieceSet().NextRotation(shapeId, rotation)
 				}
 			case *sdl.MouseButtonEvent:
-				if event.Type != sdl.MOUSEBUTTONDOWN || game.ActivePlayer != clientPlayer {
+				if event.Type != sdl.MOUSEBUTTONDOWN || fSpectate || game.ActivePlayer != clientPlayer {
 					break
 				}
 				if event.Button == sdl.BUTTON_LEFT {
 					// using event.motion does not make sense (as in original C++ code)
 					if event.X < BOARD_AREA_WIDTH {
-						gridCursor.X = event.X / GRID_CELL_SIZE * GRID_CELL_SIZE
-						gridCursor.Y = event.Y / GRID_CELL_SIZE * GRID_CELL_SIZE
-						insertPos := squares.Coord{int(gridCursor.X / GRID_CELL_SIZE), int(gridCursor.Y / GRID_CELL_SIZE)}
-						if game.TryInsert(shapeId, rotation, insertPos, clientPlayer, game.FirstRound) {
-							if fLocalMultiplayer {
-								game.Insert(shapeId, rotation, insertPos, clientPlayer)
-								if !game.AfterMove() {
-									log.Println("Game over!")
-									break
-								}
-								clientPlayer = game.ActivePlayer
-							} else {
-								SendMsg(conn, MoveReq{
-									Id:       clientId,
-									ShapeId:  shapeId,
-									Pos:      [2]int{insertPos.X, insertPos.Y},
-									Rotation: rotation,
-								})
-							}
+						insertPos, ok := gridCellAt(event.X, event.Y)
+						if !ok {
+							break
+						}
+						gridCursor.X = int32(insertPos.X) * gridCellSize()
+						gridCursor.Y = int32(insertPos.Y) * gridCellSize()
+						move := squares.Move{ShapeId: shapeId, Rotation: rotation, Pos: insertPos, PlayerId: clientPlayer}
+						if err := game.ValidateMove(move); err != nil {
+							setTitle(window, fmt.Sprintf("%s: %s", game.Rules.PieceSet().Shapes[shapeId].Name, err))
+						} else if fLocalMultiplayer {
+							game.Insert(shapeId, rotation, insertPos, clientPlayer)
+							game.AfterMove()
+						} else {
+							SendMsg(conn, MoveReq{
+								Id:       clientId,
+								ShapeId:  shapeId,
+								Pos:      [2]int{insertPos.X, insertPos.Y},
+								Rotation: rotation,
+							})
 						}
 					} else if event.Y < SELECTOR_AREA_HEIGHT {
 						if selShape := getSelection(int(event.X), int(event.Y)); selShape >= 0 {
 							shapeId = selShape
 							rotation = 0
+							shape := game.Rules.PieceSet().Shapes[shapeId]
+							setTitle(window, fmt.Sprintf("%s (%d squares)", shape.Name, shape.Size()))
 						}
 					} else {
 						if rotShape := getRotation(int(event.X), int(event.Y), shapeId); rotShape >= 0 {
@@ -320,11 +548,12 @@ func clientMain() {
 						}
 					}
 				} else if event.Button == sdl.BUTTON_RIGHT {
-					rotation = squares.GetNextRotation(shapeId, rotation)
+					rotation = game.Rules.PieceSet().NextRotation(shapeId, rotation)
 				}
 			case *sdl.MouseMotionEvent:
-				gridCursorGhost.X = event.X / GRID_CELL_SIZE * GRID_CELL_SIZE
-				gridCursorGhost.Y = event.Y / GRID_CELL_SIZE * GRID_CELL_SIZE
+				gridCursorGhost.X = event.X / gridCellSize() * gridCellSize()
+				gridCursorGhost.Y = event.Y / gridCellSize() * gridCellSize()
+				gridCursorGhost.W, gridCursorGhost.H = gridCellSize(), gridCellSize()
 				mouseActive = true
 			case *sdl.WindowEvent:
 				if event.Event == sdl.WINDOWEVENT_ENTER {
@@ -343,31 +572,120 @@ func clientMain() {
 						break
 					}
 					game = &event.Game
+					if shapeId >= game.Rules.PieceSet().Len() {
+						shapeId, rotation = 0, 0
+					}
 					if clientId != event.Id {
 						log.Printf("Updated client ID: %d\n", event.Id)
 						clientId = event.Id
 					}
-					if clientPlayer != event.PlayerId {
+					if clientRoom != event.Room {
+						log.Printf("Joined room %d\n", event.Room)
+						clientRoom = event.Room
+					}
+					if fSpectate {
+						// Show the pieces of whoever moves next
+						if game.ActivePlayer >= 0 {
+							clientPlayer = game.ActivePlayer
+						}
+						setTitle(window, "")
+					} else if clientPlayer != event.PlayerId {
 						log.Printf("Updated client player: %d\n", event.PlayerId)
 						clientPlayer = event.PlayerId
-						window.SetTitle(fmt.Sprintf("Squares (Player %d)", clientPlayer+1))
+						setTitle(window, "")
 					}
 				case MoveRes:
-					break
+					if !event.Ok && event.Error != 0 {
+						setTitle(window, event.Error.Error())
+					}
 				case OtherMoveRes:
 					pos := squares.Coord{event.Pos[0], event.Pos[1]}
 					game.Insert(event.ShapeId, event.Rotation, pos, event.PlayerId)
 					game.ActivePlayer = event.ActivePlayer
-					if event.PlayerId == squares.NPLAYERS-1 {
+					if game.Rules.IsLastPlayer(event.PlayerId) {
 						game.FirstRound = false
 					}
+					if fSpectate && game.ActivePlayer >= 0 {
+						clientPlayer = game.ActivePlayer
+						setTitle(window, "")
+					}
+					if event.Hash != 0 && event.Hash != game.Hash() {
+						log.Printf("Game state out of sync (hash %016x, server has %016x), reloading\n", game.Hash(), event.Hash)
+						SendMsg(conn, connectReq())
+					}
 				case ServerRes:
 					log.Printf("Server message: [%d] %s\n", event.Code, ServerResString(event.Code))
+				case RoomListRes:
+					s := "Rooms:\n"
+					for _, room := range event.Rooms {
+						status := "waiting"
+						if room.Ongoing {
+							status = "playing"
+						}
+						s += fmt.Sprintf("  %d. %s (%s) %d/%d %s, %d watching\n", room.Id, room.Name, room.Variant, room.Seated, room.Seats, status, room.Spectators)
+					}
+					log.Print(s)
+				case LobbyRes:
+					playerNames = make([]string, len(event.Seats))
+					s, nReady := "Lobby:\n", 0
+					for i, seat := range event.Seats {
+						playerNames[i] = seat.Name
+						switch {
+						case seat.Name == "":
+							s += fmt.Sprintf("  %d. (free)\n", i+1)
+							continue
+						case seat.Ready:
+							nReady++
+							s += fmt.Sprintf("  %d. %s, ready", i+1, seat.Name)
+						default:
+							s += fmt.Sprintf("  %d. %s", i+1, seat.Name)
+						}
+						if i == event.Host {
+							s += " (host)"
+						}
+						s += "\n"
+					}
+					log.Print(s)
+					if !fSpectate && clientPlayer < len(event.Seats) {
+						clientReady = event.Seats[clientPlayer].Ready
+					}
+					if event.Ongoing {
+						setTitle(window, "")
+					} else {
+						setTitle(window, fmt.Sprintf("%d/%d ready", nReady, len(event.Seats)))
+					}
+				case GameOverRes:
+					showGameOver(window, event.Standings)
+				case PlayerOutRes:
+					s := fmt.Sprintf("%s is out", PlayerName(playerNames, event.PlayerId))
+					log.Println(s)
+					setTitle(window, s)
+
+				case Hello:
+					if !CompatibleVersion(event) {
+						log.Fatalf("Server speaks protocol version %d to %d, this client %d to %d\n",
+							event.MinVersion, event.Version, MIN_PROTOCOL_VERSION, PROTOCOL_VERSION)
+					}
+					serverHello = true
+					serverCapabilities = SharedCapabilities(event.Capabilities)
+					log.Printf("Server protocol version %d, capabilities: %s\n", event.Version, strings.Join(serverCapabilities, ", "))
+				case RejectRes:
+					errorS := fmt.Sprintf("Rejected by server: %s", event.Reason)
+					sdl.ShowSimpleMessageBox(sdl.MESSAGEBOX_ERROR, "Error", errorS, nil)
+					log.Fatal(errorS)
+				case UnknownMessage:
+					log.Printf("Ignoring unknown message type %d\n", event.Type)
 
 				case ConnectionLost:
-					errorS := fmt.Sprintf("Connection lost: %s", event.err)
-					log.Println(errorS)
-					sdl.ShowSimpleMessageBox(sdl.MESSAGEBOX_ERROR, "Error", errorS, nil)
+					if !serverHello && !legacyServer {
+						// Servers from before the handshake hang up on a Hello
+						log.Println("Server didn't answer the hello, retrying without it")
+						legacyServer = true
+					} else {
+						errorS := fmt.Sprintf("Connection lost: %s", event.err)
+						log.Println(errorS)
+						sdl.ShowSimpleMessageBox(sdl.MESSAGEBOX_ERROR, "Error", errorS, nil)
+					}
 
 					// Retry connection
 					conn, err = setupClientNetThread(window)
@@ -389,11 +707,13 @@ func clientMain() {
 
 		// Draw grid lines
 		renderer.SetDrawColor(GRID_LINE_COLOR.R, GRID_LINE_COLOR.G, GRID_LINE_COLOR.B, GRID_LINE_COLOR.A)
-		for x := int32(0); x < BOARD_AREA_WIDTH; x += GRID_CELL_SIZE {
-			renderer.DrawLine(x, 0, x, WINDOW_HEIGHT)
+		cellSize := gridCellSize()
+		boardWidth, boardHeight := int32(game.Rules.Width)*cellSize, int32(game.Rules.Height)*cellSize
+		for x := int32(0); x <= boardWidth; x += cellSize {
+			renderer.DrawLine(x, 0, x, boardHeight)
 		}
-		for y := int32(0); y < WINDOW_HEIGHT; y += GRID_CELL_SIZE {
-			renderer.DrawLine(0, y, BOARD_AREA_WIDTH-1, y)
+		for y := int32(0); y <= boardHeight; y += cellSize {
+			renderer.DrawLine(0, y, boardWidth, y)
 		}
 
 		// Draw selector separator line
@@ -402,15 +722,15 @@ func clientMain() {
 		}
 
 		// Draw grid ghost color
-		if mouseActive && mouseHover && shouldRenderGhost(gridCursorGhost, shapeId, rotation) {
+		if mouseActive && mouseHover && !fSpectate && shouldRenderGhost(gridCursorGhost, shapeId, rotation) {
 			var useColor sdl.Color
-			if game.TryInsert(shapeId, rotation, squares.Coord{int(gridCursorGhost.X / GRID_CELL_SIZE), int(gridCursorGhost.Y / GRID_CELL_SIZE)}, clientPlayer, game.FirstRound) {
+			if pos, _ := gridCellAt(gridCursorGhost.X, gridCursorGhost.Y); game.TryInsert(shapeId, rotation, pos, clientPlayer, game.FirstRound) {
 				useColor = GRID_CURSOR_GHOST_COLORS[clientPlayer]
 			} else {
 				useColor = GRID_WRONG_COLOR
 			}
 			renderer.SetDrawColor(useColor.R, useColor.G, useColor.B, useColor.A)
-			renderShape(renderer, shapeId, rotation, gridCursorGhost, GRID_CELL_SIZE, GRID_CELL_SIZE)
+			renderShape(renderer, shapeId, rotation, gridCursorGhost, int(cellSize), int(cellSize))
 		}
 
 		renderSelector(renderer, clientPlayer, shapeId)
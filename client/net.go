@@ -15,8 +15,34 @@ import (
  * 2-byte little-endian length of the following JSON
  * JSON data
  * Req/Res only signifies direction, they do not necessarily correspond
+ *
+ * Handshake:
+ * The client starts with a Hello, the server answers with its own Hello or
+ * with a RejectRes and closes the connection if their versions don't overlap.
+ * Peers that start with anything else are from before PROTOCOL_VERSION 2,
+ * they are served without any capabilities.
+ * Message types are never renumbered, unknown ones are skipped by RecvMsg.
+ * Messages that old peers can't handle are only sent if the peer announced
+ * the capability for them, see MessageCapability and LegacyMessage.
  */
 
+const (
+	PROTOCOL_VERSION     = 2
+	MIN_PROTOCOL_VERSION = 2 // Oldest version with a Hello we still talk to
+)
+
+// Capabilities, each covers the message types listed
+const (
+	CAP_EVENTS   = "events"   // GameOverRes, PlayerOutRes
+	CAP_ROOMS    = "rooms"    // RoomListReq/Res, RoomCreateReq, RoomJoinReq, RoomLeaveReq
+	CAP_SPECTATE = "spectate" // ConnectReq.Spectate
+	CAP_BOTS     = "bots"     // AddBotsReq
+	CAP_LOBBY    = "lobby"    // LobbyRes, ReadyReq, StartReq
+)
+
+// Capabilities of this build, as client and as server
+var CAPABILITIES = []string{CAP_EVENTS, CAP_ROOMS, CAP_SPECTATE, CAP_BOTS, CAP_LOBBY}
+
 // Using iota: https://go.dev/ref/spec#Constant_declarations
 const (
 	_ = iota
@@ -26,6 +52,19 @@ const (
 	MOVE_RES
 	OTHER_MOVE_RES
 	SERVER_RES // Generic server message
+	GAME_OVER_RES
+	PLAYER_OUT_RES
+	ROOM_LIST_REQ
+	ROOM_LIST_RES
+	ROOM_CREATE_REQ
+	ROOM_JOIN_REQ
+	ROOM_LEAVE_REQ
+	ADD_BOTS_REQ
+	LOBBY_RES
+	READY_REQ
+	START_REQ
+	HELLO
+	REJECT_RES
 )
 
 const (
@@ -34,6 +73,16 @@ const (
 	S_CLIENT_REJECTED
 	S_GAME_NOT_GOING
 	S_GAME_OVER
+	S_ROOM_NOT_FOUND
+	S_NOT_IN_ROOM
+	S_ROOM_LEFT
+	S_INVALID_VARIANT
+	S_SPECTATOR
+	S_NOT_HOST
+	S_INVALID_BOT
+	S_GAME_ONGOING
+	S_NOT_SEATED
+	S_SEATS_EMPTY
 )
 
 // Description of server messages
@@ -41,6 +90,16 @@ var SERVER_RES_S = map[int]string{
 	S_CLIENT_REJECTED: "client rejected",
 	S_GAME_NOT_GOING:  "game not going",
 	S_GAME_OVER:       "game is over",
+	S_ROOM_NOT_FOUND:  "room not found",
+	S_NOT_IN_ROOM:     "not in a room",
+	S_ROOM_LEFT:       "left the room",
+	S_INVALID_VARIANT: "invalid variant",
+	S_SPECTATOR:       "spectators can't move",
+	S_NOT_HOST:        "only the host can do that",
+	S_INVALID_BOT:     "unknown bot kind",
+	S_GAME_ONGOING:    "game already started",
+	S_NOT_SEATED:      "not seated",
+	S_SEATS_EMPTY:     "there are empty seats",
 }
 
 func ServerResString(i int) string {
@@ -56,13 +115,19 @@ func ServerResString(i int) string {
 type ConnectReq struct {
 	// Empty Id: New connection
 	// With Id: Reconnect an existing session
-	Id int `json:"id"`
+	Id   int `json:"id"`
+	Room int `json:"room,omitempty"` // Empty Room: The current room, or the default one
+	// Watch without taking a seat, also while a game is ongoing
+	Spectate bool `json:"spectate,omitempty"`
+	// Shown to other players, only used on the first message of a connection
+	Name string `json:"name,omitempty"`
 }
 
 type ConnectRes struct {
 	Id       int          `json:"id"`        // Empty Id: Auth failure
-	PlayerId int          `json:"player_id"` // Range: 0-3
+	PlayerId int          `json:"player_id"` // Range: 0-3, -1 for spectators
 	Game     squares.Game `json:"game"`
+	Room     int          `json:"room,omitempty"`
 }
 
 type MoveReq struct {
@@ -73,8 +138,9 @@ type MoveReq struct {
 }
 
 type MoveRes struct {
-	Ok           bool `json:"ok"`
-	ActivePlayer int  `json:"active_player"`
+	Ok           bool              `json:"ok"`
+	ActivePlayer int               `json:"active_player"`
+	Error        squares.MoveError `json:"error,omitempty"` // Why the move was rejected
 }
 
 type OtherMoveRes struct {
@@ -83,12 +149,166 @@ type OtherMoveRes struct {
 	Pos          [2]int `json:"pos"`
 	Rotation     int    `json:"rotation"`
 	ActivePlayer int    `json:"active_player"`
+	Hash         uint64 `json:"hash,omitempty"` // Game.Hash() after the move, to detect desync
 }
 
 type ServerRes struct {
 	Code int `json:"code"`
 }
 
+type GameOverRes struct {
+	Standings []squares.Standing `json:"standings"`
+}
+
+// A player can't move any more, sent after the OtherMoveRes that caused it
+type PlayerOutRes struct {
+	PlayerId int `json:"player_id"`
+}
+
+type RoomListReq struct{}
+
+type RoomInfo struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Variant string `json:"variant"`
+	Seated  int    `json:"seated"` // Occupied seats
+	Seats   int    `json:"seats"`
+	Ongoing bool   `json:"ongoing"`
+
+	Spectators int `json:"spectators"`
+}
+
+type RoomListRes struct {
+	Rooms []RoomInfo `json:"rooms"`
+}
+
+// Open a new room and join it, answered like a ConnectReq
+type RoomCreateReq struct {
+	Name    string `json:"name"`
+	Variant string `json:"variant"`          // As in position strings, e.g. "duo" or "classic+pentominoes"
+	Player  string `json:"player,omitempty"` // Same as ConnectReq.Name
+}
+
+// Leave the current room and join another, answered like a ConnectReq
+type RoomJoinReq struct {
+	Room     int  `json:"room"`
+	Spectate bool `json:"spectate,omitempty"`
+}
+
+type RoomLeaveReq struct{}
+
+// Fill empty seats of the room with server-side bots, host only.
+// The game starts when all seats are taken.
+type AddBotsReq struct {
+	Kind  string `json:"kind"`            // See BOT_KINDS, empty for the default
+	Count int    `json:"count,omitempty"` // Empty Count: All empty seats
+}
+
+// Seats of the room, sent to everyone in it whenever they change
+type LobbyRes struct {
+	Seats   []SeatInfo `json:"seats"` // Indexed by player id
+	Host    int        `json:"host"`  // Player id of the host, -1 for none
+	Ongoing bool       `json:"ongoing"`
+}
+
+type SeatInfo struct {
+	Name  string `json:"name"` // Empty Name: Free seat
+	Ready bool   `json:"ready"`
+	Bot   bool   `json:"bot,omitempty"`
+}
+
+// Mark the seat as ready, the game starts once all seats are
+type ReadyReq struct {
+	Ready bool `json:"ready"`
+}
+
+// Start the game without waiting for everyone to be ready, host only
+type StartReq struct{}
+
+// First message in both directions
+type Hello struct {
+	Version      int      `json:"version"`
+	MinVersion   int      `json:"min_version"` // Oldest version the sender can talk to
+	Capabilities []string `json:"capabilities"`
+}
+
+// The server doesn't talk to this client, sent instead of a Hello
+type RejectRes struct {
+	Reason     string `json:"reason"`
+	Version    int    `json:"version"` // Versions the server supports
+	MinVersion int    `json:"min_version"`
+}
+
+// A message of a type this build doesn't know, returned by RecvMsg
+type UnknownMessage struct {
+	Type uint16
+	Data []byte
+}
+
+// Check if two peers can talk to each other
+func CompatibleVersion(hello Hello) bool {
+	return hello.Version >= MIN_PROTOCOL_VERSION && hello.MinVersion <= PROTOCOL_VERSION
+}
+
+// Capabilities of this build that the peer announced too
+func SharedCapabilities(capabilities []string) []string {
+	shared := make([]string, 0, len(CAPABILITIES))
+	for _, c := range CAPABILITIES {
+		if HasCapability(capabilities, c) {
+			shared = append(shared, c)
+		}
+	}
+	return shared
+}
+
+// Capability a peer needs to handle a message, empty if every peer can.
+// Answers to requests, like RoomListRes, go to peers that sent the request.
+func MessageCapability(message any) string {
+	switch message.(type) {
+	case GameOverRes, PlayerOutRes:
+		return CAP_EVENTS
+	case LobbyRes:
+		return CAP_LOBBY
+	}
+	return ""
+}
+
+// What peers without the capability for a message get instead, nil if nothing.
+// They see eliminated players skipped in OtherMoveRes.ActivePlayer, and are
+// always ready in the lobby.
+func LegacyMessage(message any) any {
+	switch message.(type) {
+	case GameOverRes:
+		return ServerRes{S_GAME_OVER}
+	}
+	return nil
+}
+
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Display name of a player, names may be nil or have empty entries
+func PlayerName(names []string, playerId int) string {
+	if playerId >= 0 && playerId < len(names) && names[playerId] != "" {
+		return names[playerId]
+	}
+	return fmt.Sprintf("Player %d", playerId+1)
+}
+
+func StandingsString(standings []squares.Standing, names []string) string {
+	s := ""
+	for _, st := range standings {
+		s += fmt.Sprintf("%d. %s: %d\n", st.Rank, PlayerName(names, st.PlayerId), st.Score)
+	}
+	return s
+}
+
 func SendMsg(w io.Writer, message any) error {
 	var msgType uint16
 	switch message.(type) {
@@ -104,6 +324,32 @@ func SendMsg(w io.Writer, message any) error {
 		msgType = OTHER_MOVE_RES
 	case ServerRes:
 		msgType = SERVER_RES
+	case GameOverRes:
+		msgType = GAME_OVER_RES
+	case PlayerOutRes:
+		msgType = PLAYER_OUT_RES
+	case RoomListReq:
+		msgType = ROOM_LIST_REQ
+	case RoomListRes:
+		msgType = ROOM_LIST_RES
+	case RoomCreateReq:
+		msgType = ROOM_CREATE_REQ
+	case RoomJoinReq:
+		msgType = ROOM_JOIN_REQ
+	case RoomLeaveReq:
+		msgType = ROOM_LEAVE_REQ
+	case AddBotsReq:
+		msgType = ADD_BOTS_REQ
+	case LobbyRes:
+		msgType = LOBBY_RES
+	case ReadyReq:
+		msgType = READY_REQ
+	case StartReq:
+		msgType = START_REQ
+	case Hello:
+		msgType = HELLO
+	case RejectRes:
+		msgType = REJECT_RES
 	default:
 		return errors.New("not implemented")
 	}
@@ -163,8 +409,61 @@ func RecvMsg(r io.Reader) (any, error) {
 		m := ServerRes{}
 		err = json.Unmarshal(data, &m)
 		message = m
+	case GAME_OVER_RES:
+		m := GameOverRes{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case PLAYER_OUT_RES:
+		m := PlayerOutRes{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ROOM_LIST_REQ:
+		m := RoomListReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ROOM_LIST_RES:
+		m := RoomListRes{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ROOM_CREATE_REQ:
+		m := RoomCreateReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ROOM_JOIN_REQ:
+		m := RoomJoinReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ROOM_LEAVE_REQ:
+		m := RoomLeaveReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ADD_BOTS_REQ:
+		m := AddBotsReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case LOBBY_RES:
+		m := LobbyRes{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case READY_REQ:
+		m := ReadyReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case START_REQ:
+		m := StartReq{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case HELLO:
+		m := Hello{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case REJECT_RES:
+		m := RejectRes{}
+		err = json.Unmarshal(data, &m)
+		message = m
 	default:
-		return nil, fmt.Errorf("not implemented: %d", msgType)
+		// Probably from a newer peer, the stream is still in sync
+		message = UnknownMessage{msgType, data}
 	}
 	return message, err
 }
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+const DEFAULT_ROOM = 1 // Joined by clients that don't ask for a room, never closed
+
+// One table with its own game, run by its own goroutine (see Room.run).
+// Messages reach it through ch, sent by the dispatcher in server.go.
+type Room struct {
+	Id   int
+	Name string
+	ch   chan ClientMessage
+	// Moves of bots, separate from ch as bots may still be thinking when it's closed
+	botCh chan ClientMessage
+
+	// Only touched by the room goroutine
+	game        *squares.Game
+	lobby       []*ClientInfo        // One entry per seat, nil if free
+	ready       map[*ClientInfo]bool // Seated players that may start, bots always are
+	spectators  []*ClientInfo        // Get every broadcast, never seated
+	gameOngoing bool
+	pendingOut  []int // Players eliminated by the move being processed
+
+	mu   sync.Mutex
+	info RoomInfo // Copy of the state for room lists, guarded by mu
+}
+
+func newRoom(id int, name string, game *squares.Game) *Room {
+	room := &Room{
+		Id:    id,
+		Name:  name,
+		ch:    make(chan ClientMessage, 8),
+		botCh: make(chan ClientMessage, 1),
+		game:  game,
+	}
+	room.resetLobby()
+	room.game.AddListener(squares.ListenerFunc(room.handleGameEvent))
+	room.publish()
+	go room.run()
+	return room
+}
+
+// Process messages until the dispatcher closes the room
+func (room *Room) run() {
+	for {
+		select {
+		case cm, ok := <-room.ch:
+			if !ok {
+				room.logf("Room closed\n")
+				return
+			}
+			room.processClientMessage(cm)
+		case cm := <-room.botCh:
+			room.processClientMessage(cm)
+		}
+		room.publish()
+	}
+}
+
+func (room *Room) logf(format string, v ...any) {
+	log.Printf("[%s] "+format, append([]any{room.Name}, v...)...)
+}
+
+// Number of occupied seats, by players and bots
+func (room *Room) seated() int {
+	seated := 0
+	for _, ci := range room.lobby {
+		if ci != nil {
+			seated++
+		}
+	}
+	return seated
+}
+
+func (room *Room) publish() {
+	seated := room.seated()
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	room.info = RoomInfo{
+		Id:      room.Id,
+		Name:    room.Name,
+		Variant: variantName(room.game.Rules),
+		Seated:  seated,
+		Seats:   room.game.Rules.NPlayers,
+		Ongoing: room.gameOngoing,
+
+		Spectators: len(room.spectators),
+	}
+}
+
+func (room *Room) Info() RoomInfo {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return room.info
+}
+
+func (room *Room) findClientInfoSlot(ci *ClientInfo) int {
+	for i := range room.lobby {
+		if room.lobby[i] == ci {
+			return i
+		}
+	}
+	return -1
+}
+
+// Seat a client in the lobby, return its lobby slot index or -1 if it's full
+func (room *Room) addClientToLobby(ci *ClientInfo) int {
+	for i := range room.lobby {
+		if room.lobby[i] == nil {
+			room.lobby[i] = ci
+			return i
+		}
+	}
+	return -1
+}
+
+func (room *Room) findSpectator(ci *ClientInfo) int {
+	for i := range room.spectators {
+		if room.spectators[i] == ci {
+			return i
+		}
+	}
+	return -1
+}
+
+func (room *Room) removeSpectator(ci *ClientInfo) {
+	if i := room.findSpectator(ci); i != -1 {
+		room.spectators = append(room.spectators[:i], room.spectators[i+1:]...)
+	}
+}
+
+// Send a message to all players and spectators
+func (room *Room) broadcast(message any) {
+	for _, ci := range room.lobby {
+		if ci != nil {
+			ci.Send(message)
+		}
+	}
+	for _, ci := range room.spectators {
+		ci.Send(message)
+	}
+}
+
+// The first seated player that isn't a bot, who may add bots and start the game.
+// Clients that can't send StartReq are only picked if there is nobody else.
+func (room *Room) host() *ClientInfo {
+	var host *ClientInfo
+	for _, ci := range room.lobby {
+		if ci == nil || ci.bot != nil {
+			continue
+		}
+		if HasCapability(ci.capabilities, CAP_LOBBY) {
+			return ci
+		}
+		if host == nil {
+			host = ci
+		}
+	}
+	return host
+}
+
+// Bots and clients that can't send ReadyReq are always ready
+func (room *Room) isReady(ci *ClientInfo) bool {
+	if ci == nil {
+		return false
+	}
+	return ci.bot != nil || !HasCapability(ci.capabilities, CAP_LOBBY) || room.ready[ci]
+}
+
+// Display names of the seated players, for logs and records
+func (room *Room) playerNames() []string {
+	names := make([]string, len(room.lobby))
+	for i, ci := range room.lobby {
+		if ci != nil {
+			names[i] = ci.Name()
+		}
+	}
+	return names
+}
+
+func (room *Room) lobbyRes() LobbyRes {
+	res := LobbyRes{Seats: make([]SeatInfo, room.game.Rules.NPlayers), Host: -1, Ongoing: room.gameOngoing}
+	host := room.host()
+	for i, ci := range room.lobby {
+		if ci == nil {
+			continue
+		}
+		res.Seats[i] = SeatInfo{Name: ci.Name(), Ready: room.isReady(ci), Bot: ci.bot != nil}
+		if ci == host {
+			res.Host = i
+		}
+	}
+	return res
+}
+
+// Start the game once every seat is taken and ready
+func (room *Room) startIfReady() {
+	if room.seated() < room.game.Rules.NPlayers {
+		return
+	}
+	for _, ci := range room.lobby {
+		if !room.isReady(ci) {
+			return
+		}
+	}
+	room.startGame()
+}
+
+func (room *Room) startGame() {
+	room.gameOngoing = true
+	room.game.Reset()
+	room.logf("Game started: %s\n", strings.Join(room.playerNames(), ", "))
+	for _, spectator := range room.spectators {
+		spectator.Send(ConnectRes{spectator.id, -1, *room.game.Clone(), room.Id})
+	}
+	room.broadcast(room.lobbyRes())
+	room.startBotTurn()
+}
+
+func (room *Room) resetLobby() {
+	room.lobby = make([]*ClientInfo, room.game.Rules.NPlayers)
+	room.ready = make(map[*ClientInfo]bool)
+}
+
+func (room *Room) processClientMessage(cm ClientMessage) {
+	ci := cm.ci
+	num := room.findClientInfoSlot(ci)
+	game := room.game
+SwitchCMType:
+	switch req := cm.m.(type) {
+	case ConnectReq:
+		if num != -1 {
+			// Existing connection as ping
+			ci.Send(ConnectRes{ci.id, num, *game.Clone(), room.Id})
+			ci.Send(room.lobbyRes())
+			break
+		}
+		if ci.capabilities == nil && !legacyRules(game.Rules) {
+			// Clients from before the handshake only know the classic game
+			room.logf("Client[?] %s can't play %s\n", ci.Name(), variantName(game.Rules))
+			ci.Send(ServerRes{S_CLIENT_REJECTED})
+			break
+		}
+
+		if req.Spectate {
+			if room.findSpectator(ci) == -1 {
+				room.spectators = append(room.spectators, ci)
+				room.logf("%s is spectating\n", ci.Name())
+			}
+			ci.Send(ConnectRes{ci.id, -1, *game.Clone(), room.Id})
+			ci.Send(room.lobbyRes())
+		} else if room.gameOngoing {
+			// Handle potential reconnection
+			for i := range room.lobby {
+				if room.lobby[i] != nil && room.lobby[i].bot == nil && req.Id == room.lobby[i].id {
+					room.logf("Client[%d] %s reconnected as %s (was %s)\n",
+						i, ci.Name(), ci.conn.RemoteAddr(), room.lobby[i].conn.RemoteAddr())
+					room.lobby[i].conn.Close()
+					room.lobby[i] = ci
+					ci.Send(ConnectRes{ci.id, i, *game.Clone(), room.Id})
+					room.broadcast(room.lobbyRes())
+					break SwitchCMType
+				}
+			}
+
+			// Unrecognized connection, it may still try another room
+			room.logf("Client[?] %s connected while game ongoing\n", ci.Name())
+			ci.Send(ServerRes{S_CLIENT_REJECTED})
+		} else {
+			// New connection as join request
+			if num = room.addClientToLobby(ci); num == -1 {
+				room.logf("Client[?] %s connected while all seats are taken\n", ci.Name())
+				ci.Send(ServerRes{S_CLIENT_REJECTED})
+				break
+			}
+			room.removeSpectator(ci)
+			room.logf("Client[%d] %s joined\n", num, ci.Name())
+			ci.Send(ConnectRes{ci.id, num, *game.Clone(), room.Id})
+			room.broadcast(room.lobbyRes())
+			room.startIfReady()
+		}
+	case MoveReq:
+		if room.findSpectator(ci) != -1 {
+			ci.Send(ServerRes{S_SPECTATOR})
+			break
+		}
+		if !room.gameOngoing || num == -1 {
+			ci.Send(ServerRes{S_GAME_NOT_GOING})
+			break
+		}
+		pos := squares.Coord{req.Pos[0], req.Pos[1]}
+		move := squares.Move{ShapeId: req.ShapeId, Rotation: req.Rotation, Pos: pos, PlayerId: num}
+		if err := game.ValidateMove(move); err != nil {
+			room.logf("Rejected move %s from %s: %s\n", game.Rules.PieceSet().FormatMove(move), ci.Name(), err)
+			code := squares.ERR_ILLEGAL_MOVE
+			var moveErr squares.MoveError
+			if errors.As(err, &moveErr) {
+				code = moveErr
+			}
+			ci.Send(MoveRes{
+				Ok:           false,
+				ActivePlayer: game.ActivePlayer,
+				Error:        code,
+			})
+			break
+		}
+		game.Insert(req.ShapeId, req.Rotation, pos, num)
+		if fLogBoard {
+			room.logf("Board after %s:\n%s", game.Rules.PieceSet().FormatMove(move), game)
+		}
+		if game.AfterMove() {
+			room.broadcast(OtherMoveRes{
+				PlayerId:     num,
+				ShapeId:      req.ShapeId,
+				Pos:          req.Pos,
+				Rotation:     req.Rotation,
+				ActivePlayer: game.ActivePlayer,
+				Hash:         game.Hash(),
+			})
+			for _, playerId := range room.pendingOut {
+				room.broadcast(PlayerOutRes{playerId})
+			}
+			room.pendingOut = room.pendingOut[:0]
+			room.startBotTurn()
+		} else {
+			// Game over
+			room.gameOngoing = false
+			room.broadcast(GameOverRes{game.Standings(squares.SCORING_ADVANCED)})
+			if fRecordDir != "" {
+				room.saveRecord()
+			}
+			players := room.lobby
+			game.Reset()
+			room.resetLobby()
+			room.pendingOut = room.pendingOut[:0]
+			// Everyone has to join again, players are shown the empty seats too
+			lobby := room.lobbyRes()
+			room.broadcast(lobby)
+			for _, ci := range players {
+				if ci != nil {
+					ci.Send(lobby)
+				}
+			}
+		}
+	case ClientDisconnect, RoomLeaveReq:
+		room.removeSpectator(ci)
+		if num == -1 {
+			break
+		}
+		if room.gameOngoing {
+			room.logf("Client[%d] %s left while game ongoing", num, ci.Name())
+			// just wait for reconnection
+		} else {
+			room.lobby[num] = nil
+			delete(room.ready, ci)
+			if room.host() == nil {
+				// Nobody left to play with the bots
+				room.resetLobby()
+			}
+			room.broadcast(room.lobbyRes())
+		}
+	case AddBotsReq:
+		if room.gameOngoing {
+			ci.Send(ServerRes{S_GAME_ONGOING})
+			break
+		}
+		if ci != room.host() {
+			ci.Send(ServerRes{S_NOT_HOST})
+			break
+		}
+		if err := room.addBots(req.Kind, req.Count); err != nil {
+			room.logf("%s\n", err)
+			ci.Send(ServerRes{S_INVALID_BOT})
+			break
+		}
+		room.broadcast(room.lobbyRes())
+		room.startIfReady()
+	case ReadyReq:
+		if room.gameOngoing {
+			ci.Send(ServerRes{S_GAME_ONGOING})
+			break
+		}
+		if num == -1 {
+			ci.Send(ServerRes{S_NOT_SEATED})
+			break
+		}
+		room.ready[ci] = req.Ready
+		room.broadcast(room.lobbyRes())
+		room.startIfReady()
+	case StartReq:
+		if room.gameOngoing {
+			ci.Send(ServerRes{S_GAME_ONGOING})
+			break
+		}
+		if ci != room.host() {
+			ci.Send(ServerRes{S_NOT_HOST})
+			break
+		}
+		if room.seated() < game.Rules.NPlayers {
+			ci.Send(ServerRes{S_SEATS_EMPTY})
+			break
+		}
+		room.startGame()
+	default:
+		room.logf("Unknown message type: %T\n", req)
+	}
+}
+
+// Archive the finished game in fRecordDir
+func (room *Room) saveRecord() {
+	rec := squares.NewRecord(room.game)
+	for i := 0; i < room.game.Rules.NPlayers; i++ {
+		rec.SetTag(fmt.Sprintf("Player%d", i+1), room.lobby[i].Name())
+	}
+	rec.SetTag("Room", room.Name)
+	filename := filepath.Join(fRecordDir, fmt.Sprintf("%s-%d.sqr", time.Now().Format("20060102-150405"), room.Id))
+	f, err := os.Create(filename)
+	if err != nil {
+		room.logf("%s\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := rec.WriteTo(f); err != nil {
+		room.logf("%s\n", err)
+		return
+	}
+	room.logf("Game record saved to %s\n", filename)
+}
+
+func (room *Room) handleGameEvent(game *squares.Game, e squares.Event) {
+	switch e := e.(type) {
+	case squares.TurnChangedEvent:
+		// Too noisy
+	case squares.PlayerEliminatedEvent:
+		room.logf("%s is out\n", PlayerName(room.playerNames(), e.PlayerId))
+		room.pendingOut = append(room.pendingOut, e.PlayerId)
+	case squares.GameOverEvent:
+		room.logf("Game over\n%s", StandingsString(e.Standings, room.playerNames()))
+	default:
+		room.logf("%s\n", e)
+	}
+}
+
+// Variant name with the piece set, as in position strings
+func variantName(rules squares.Rules) string {
+	if pieces := rules.PieceSet(); pieces != squares.PIECES_STANDARD {
+		return rules.Name + "+" + pieces.Name
+	}
+	return rules.Name
+}
+
+// Whether clients from before the handshake can play, they assume the
+// classic board and the standard pieces
+func legacyRules(rules squares.Rules) bool {
+	if rules.PieceSet() != squares.PIECES_STANDARD {
+		return false
+	}
+	rules.Pieces = nil
+	return reflect.DeepEqual(rules, squares.RULES_CLASSIC)
+}
+
+func parseVariant(s string) (squares.Rules, error) {
+	name, piecesName, custom := strings.Cut(s, "+")
+	rules, ok := squares.GetRules(name)
+	if !ok {
+		return squares.Rules{}, fmt.Errorf("unknown variant %q", name)
+	}
+	if custom {
+		if rules.Pieces, ok = squares.GetPieceSet(piecesName); !ok {
+			return squares.Rules{}, fmt.Errorf("unknown piece set %q", piecesName)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	squares "github.com/iBug/Squares-go"
+)
+
+// A client connected through a pipe, with everything the room sends it collected
+type testClient struct {
+	*ClientInfo
+	received chan any
+}
+
+func newTestClient(t *testing.T, id int, capabilities []string) *testClient {
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	tc := &testClient{
+		ClientInfo: &ClientInfo{id: id, conn: server, capabilities: capabilities},
+		received:   make(chan any, 1024),
+	}
+	go func() {
+		defer client.Close()
+		for {
+			m, err := RecvMsg(client)
+			if err != nil {
+				return
+			}
+			tc.received <- m
+		}
+	}()
+	return tc
+}
+
+// Skip messages until one of type T arrives
+func receive[T any](t *testing.T, tc *testClient) T {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m := <-tc.received:
+			if m, ok := m.(T); ok {
+				return m
+			}
+		case <-timeout:
+			var m T
+			t.Fatalf("%s got no %T", tc.Name(), m)
+			return m
+		}
+	}
+}
+
+func newTestRoom(t *testing.T, rules squares.Rules) *Room {
+	room := newRoom(DEFAULT_ROOM, "test", squares.NewGame(rules))
+	t.Cleanup(func() { close(room.ch) })
+	return room
+}
+
+// Clients without the lobby capability are always ready, the last of them to
+// take a seat starts the game
+func TestLegacyClientsStartGame(t *testing.T) {
+	room := newTestRoom(t, squares.RULES_CLASSIC)
+	for i := 0; i < room.game.Rules.NPlayers; i++ {
+		if room.gameOngoing {
+			t.Fatalf("game started with %d players", i)
+		}
+		tc := newTestClient(t, i+1, nil)
+		room.processClientMessage(ClientMessage{tc.ClientInfo, ConnectReq{}})
+	}
+	if !room.gameOngoing {
+		t.Error("game didn't start once every seat was taken")
+	}
+}
+
+// A ready host waits for the last seat, then the game starts
+func TestJoinStartsGameWhenReady(t *testing.T) {
+	room := newTestRoom(t, squares.RULES_DUO)
+	host := newTestClient(t, 1, CAPABILITIES)
+	room.processClientMessage(ClientMessage{host.ClientInfo, ConnectReq{}})
+	room.processClientMessage(ClientMessage{host.ClientInfo, ReadyReq{Ready: true}})
+	if room.gameOngoing {
+		t.Fatal("game started with one player")
+	}
+	other := newTestClient(t, 2, []string{CAP_EVENTS})
+	room.processClientMessage(ClientMessage{other.ClientInfo, ConnectReq{}})
+	if !room.gameOngoing {
+		t.Error("game didn't start when the last seat was taken")
+	}
+}
+
+func TestRejectedMoveError(t *testing.T) {
+	room := newTestRoom(t, squares.RULES_DUO)
+	first := newTestClient(t, 1, []string{CAP_EVENTS})
+	second := newTestClient(t, 2, []string{CAP_EVENTS})
+	room.processClientMessage(ClientMessage{first.ClientInfo, ConnectReq{}})
+	room.processClientMessage(ClientMessage{second.ClientInfo, ConnectReq{}})
+	if !room.gameOngoing {
+		t.Fatal("game didn't start")
+	}
+	room.processClientMessage(ClientMessage{first.ClientInfo, MoveReq{ShapeId: 0, Rotation: 0, Pos: [2]int{0, 0}}})
+	if res := receive[MoveRes](t, first); res.Ok || res.Error != squares.ERR_MISSES_START {
+		t.Errorf("got %+v, want error %q", res, squares.ERR_MISSES_START)
+	}
+}
+
+// After the game the seats are free again, and players are told so
+func TestGameOverResetsLobby(t *testing.T) {
+	room := newTestRoom(t, squares.RULES_DUO)
+	clients := []*testClient{newTestClient(t, 1, CAPABILITIES), newTestClient(t, 2, CAPABILITIES)}
+	for _, tc := range clients {
+		room.processClientMessage(ClientMessage{tc.ClientInfo, ConnectReq{}})
+		room.processClientMessage(ClientMessage{tc.ClientInfo, ReadyReq{Ready: true}})
+	}
+	for room.gameOngoing {
+		playerId := room.game.ActivePlayer
+		m := room.game.LegalMoves(playerId)[0]
+		req := MoveReq{ShapeId: m.ShapeId, Pos: [2]int{m.Pos.X, m.Pos.Y}, Rotation: m.Rotation}
+		room.processClientMessage(ClientMessage{clients[playerId].ClientInfo, req})
+	}
+	for _, tc := range clients {
+		receive[GameOverRes](t, tc)
+		lobby := receive[LobbyRes](t, tc)
+		if lobby.Ongoing || lobby.Seats[0] != (SeatInfo{}) || lobby.Seats[1] != (SeatInfo{}) {
+			t.Errorf("%s got lobby %+v after the game, want empty seats", tc.Name(), lobby)
+		}
+	}
+}
+
+func TestLegacyRules(t *testing.T) {
+	tetrominoes, err := squares.GeneratePieceSet("tetrominoes", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard := squares.RULES_CLASSIC
+	standard.Pieces = squares.PIECES_STANDARD
+	custom := squares.RULES_CLASSIC
+	custom.Pieces = tetrominoes
+	tests := []struct {
+		rules squares.Rules
+		want  bool
+	}{
+		{squares.RULES_CLASSIC, true},
+		{standard, true},
+		{squares.RULES_BLOKUS, false},
+		{squares.RULES_DUO, false},
+		{custom, false},
+	}
+	for _, tt := range tests {
+		if got := legacyRules(tt.rules); got != tt.want {
+			t.Errorf("%s: got %v, want %v", variantName(tt.rules), got, tt.want)
+		}
+	}
+}
+
+// Clients from before the handshake can't take a seat in other variants
+func TestLegacyClientRejected(t *testing.T) {
+	room := newTestRoom(t, squares.RULES_DUO)
+	legacy := newTestClient(t, 1, nil)
+	room.processClientMessage(ClientMessage{legacy.ClientInfo, ConnectReq{}})
+	if res := receive[ServerRes](t, legacy); res.Code != S_CLIENT_REJECTED {
+		t.Errorf("got %+v, want %s", res, ServerResString(S_CLIENT_REJECTED))
+	}
+	if room.seated() != 0 {
+		t.Errorf("%d seated, want none", room.seated())
+	}
+
+	// Even without shared capabilities, clients with a handshake know the rules
+	room.processClientMessage(ClientMessage{newTestClient(t, 2, []string{}).ClientInfo, ConnectReq{}})
+	if room.seated() != 1 {
+		t.Errorf("%d seated, want 1", room.seated())
+	}
+}
@@ -2,19 +2,34 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"net"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	squares "github.com/iBug/Squares-go"
+	"github.com/iBug/Squares-go/ai"
 )
 
 // Use as "connection control block"
 type ClientInfo struct {
 	id   int
+	name string // Set along with id, never changed after that
 	conn net.Conn
+	room *Room // Only touched by the dispatcher
+
+	capabilities []string // Agreed on in the handshake, before any other message
+
+	bot     ai.Player // Seats taken by server-side bots have no connection
+	botKind string
+
+	sendMu sync.Mutex // Rooms and the dispatcher may write at the same time
 }
 
 type ClientMessage struct {
@@ -24,11 +39,15 @@ type ClientMessage struct {
 
 type ClientDisconnect struct{} // Internal data type
 
-const IDRANGE = 999999999
+const (
+	IDRANGE         = 999999999
+	MAX_NAME_LENGTH = 24 // In characters
+)
 
 var (
-	lobby       []*ClientInfo
-	gameOngoing = false
+	rooms      = make(map[int]*Room)
+	members    = make(map[*Room]int) // Open connections in each room
+	nextRoomId = DEFAULT_ROOM
 
 	r1 = rand.New(rand.NewSource(time.Now().UnixNano()))
 )
@@ -37,159 +56,209 @@ func generateClientID() int {
 	return r1.Intn(IDRANGE) + 1
 }
 
-func findClientInfoSlot(ci *ClientInfo) int {
-	for i := range lobby {
-		if lobby[i] == ci {
-			return i
+// Display name, falls back to the client ID
+func (ci *ClientInfo) Name() string {
+	if ci.name == "" {
+		return fmt.Sprintf("Client %d", ci.id)
+	}
+	return ci.name
+}
+
+// Drop control characters and surrounding spaces, and limit the length
+func cleanName(name string) string {
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
 		}
+		return r
+	}, name))
+	if runes := []rune(name); len(runes) > MAX_NAME_LENGTH {
+		name = strings.TrimSpace(string(runes[:MAX_NAME_LENGTH]))
 	}
-	return -1
+	return name
 }
 
-// Add a client to the lobby, return its lobby slot index
-func addClientToLobby(ci *ClientInfo) int {
-	for i := range lobby {
-		if lobby[i] == nil {
-			lobby[i] = ci
-			return i
+func (ci *ClientInfo) Send(message any) error {
+	if ci.bot != nil {
+		return nil
+	}
+	if capability := MessageCapability(message); capability != "" && !HasCapability(ci.capabilities, capability) {
+		// The client wouldn't understand it
+		if message = LegacyMessage(message); message == nil {
+			return nil
 		}
 	}
-	lobby = append(lobby, ci)
-	return len(lobby) - 1
+	ci.sendMu.Lock()
+	defer ci.sendMu.Unlock()
+	return SendMsg(ci.conn, message)
+}
+
+// Answer the Hello a client starts with, false if the client is turned away
+func (ci *ClientInfo) handshake(hello Hello) bool {
+	if !CompatibleVersion(hello) {
+		log.Printf("%s: rejected protocol version %d (min %d)\n", ci.conn.RemoteAddr(), hello.Version, hello.MinVersion)
+		ci.Send(RejectRes{
+			Reason:     fmt.Sprintf("protocol version %d not supported, server supports %d to %d", hello.Version, MIN_PROTOCOL_VERSION, PROTOCOL_VERSION),
+			Version:    PROTOCOL_VERSION,
+			MinVersion: MIN_PROTOCOL_VERSION,
+		})
+		return false
+	}
+	ci.capabilities = SharedCapabilities(hello.Capabilities)
+	ci.Send(Hello{PROTOCOL_VERSION, MIN_PROTOCOL_VERSION, CAPABILITIES})
+	return true
 }
 
 func handleClient(ci *ClientInfo, ch chan<- ClientMessage) {
 	defer ci.conn.Close()
-	for {
+	for first := true; ; first = false {
 		msg, err := RecvMsg(ci.conn)
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) {
-				// serverMain closed the connection
-				break
+				// A room closed the connection after a reconnection
 			} else if err == io.EOF {
-				log.Printf("Client %d disconnected\n", ci.id)
+				log.Printf("%s disconnected\n", ci.Name())
 			} else {
 				log.Println(err)
 			}
-			ch <- ClientMessage{ci, ClientDisconnect{}}
+			if !first {
+				ch <- ClientMessage{ci, ClientDisconnect{}}
+			}
 			break
 		}
+		switch m := msg.(type) {
+		case Hello:
+			if !first {
+				log.Printf("%s: unexpected hello\n", ci.conn.RemoteAddr())
+			} else if !ci.handshake(m) {
+				return
+			}
+			continue
+		case UnknownMessage:
+			log.Printf("%s: ignoring unknown message type %d\n", ci.conn.RemoteAddr(), m.Type)
+			continue
+		}
+		// Clients from before the handshake start right away, without capabilities
 		ch <- ClientMessage{ci, msg}
 	}
 }
 
-func processClientMessage(cm ClientMessage) {
-	ci := cm.ci
-	num := findClientInfoSlot(ci)
-SwitchCMType:
-	switch req := cm.m.(type) {
-	case ConnectReq:
-		if ci.id == 0 && req.Id != 0 {
-			// Register ID with connection control block
-			ci.id = req.Id
-		}
-		if num != -1 {
-			// Existing connection as ping
-			SendMsg(ci.conn, ConnectRes{ci.id, num, *game})
-			break
+func createRoom(name string, rules squares.Rules) *Room {
+	id := nextRoomId
+	nextRoomId++
+	room := newRoom(id, name, squares.NewGame(rules))
+	rooms[id] = room
+	log.Printf("Room %d %q opened (%s)\n", id, name, variantName(rules))
+	return room
+}
+
+// Move a client into a room, answered by the room with a ConnectRes
+func joinRoom(ci *ClientInfo, roomId int, req ConnectReq) {
+	room, ok := rooms[roomId]
+	if !ok {
+		ci.Send(ServerRes{S_ROOM_NOT_FOUND})
+		return
+	}
+	if ci.room != room {
+		if ci.room != nil {
+			leaveRoom(ci, RoomLeaveReq{})
 		}
+		ci.room = room
+		members[room]++
+	}
+	room.ch <- ClientMessage{ci, req}
+}
 
-		if gameOngoing {
-			// Handle potential reconnection
-			for i := range lobby {
-				if req.Id == lobby[i].id {
-					log.Printf("Client[%d] %d reconnected as %s (was %s)\n",
-						i, ci.id, ci.conn.RemoteAddr(), lobby[i].conn.RemoteAddr())
-					lobby[i].conn.Close()
-					lobby[i] = ci
-					SendMsg(ci.conn, ConnectRes{ci.id, i, *game})
-					break SwitchCMType
-				}
-			}
+// Take a client out of its room, which is closed once nobody is left
+func leaveRoom(ci *ClientInfo, m any) {
+	room := ci.room
+	ci.room = nil
+	room.ch <- ClientMessage{ci, m}
+	members[room]--
+	if members[room] == 0 && room.Id != DEFAULT_ROOM {
+		close(room.ch)
+		delete(rooms, room.Id)
+		delete(members, room)
+		log.Printf("Room %d %q closed\n", room.Id, room.Name)
+	}
+}
+
+func listRooms() []RoomInfo {
+	list := make([]RoomInfo, 0, len(rooms))
+	for _, room := range rooms {
+		list = append(list, room.Info())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
 
-			// Unrecognized connection
-			log.Printf("Client[?] %d connected while game ongoing\n", ci.id)
-			SendMsg(ci.conn, ServerRes{S_CLIENT_REJECTED})
-			ci.conn.Close()
-		} else {
-			// New connection as join request
-			ci.id = req.Id
+// Route client messages to their rooms and handle the ones about rooms
+func dispatch(chCM <-chan ClientMessage) {
+	for cm := range chCM {
+		ci := cm.ci
+		if ci.id == 0 {
+			// Register ID and name with connection control block
+			switch req := cm.m.(type) {
+			case ConnectReq:
+				ci.id, ci.name = req.Id, cleanName(req.Name)
+			case RoomCreateReq:
+				ci.name = cleanName(req.Player)
+			}
 			if ci.id == 0 {
 				ci.id = generateClientID()
 			}
-			num = addClientToLobby(ci)
-			if len(lobby) == squares.NPLAYERS {
-				// Start game
-				gameOngoing = true
-				game.Reset()
-			}
-			SendMsg(ci.conn, ConnectRes{ci.id, num, *game})
-		}
-	case MoveReq:
-		if !gameOngoing {
-			SendMsg(ci.conn, ServerRes{S_GAME_NOT_GOING})
-			break
-		}
-		if num != game.ActivePlayer {
-			log.Printf("Received move from inactive player %d\n", num)
-			break
 		}
 
-		pos := squares.Coord{req.Pos[0], req.Pos[1]}
-		if !game.TryInsert(req.ShapeId, req.Rotation, pos, num, game.FirstRound) {
-			SendMsg(ci.conn, MoveRes{
-				Ok:           false,
-				ActivePlayer: game.ActivePlayer,
-			})
-			break
-		}
-		game.Insert(req.ShapeId, req.Rotation, pos, num)
-		if game.AfterMove() {
-			for i := 0; i < squares.NPLAYERS; i++ {
-				SendMsg(lobby[i].conn, OtherMoveRes{
-					PlayerId:     num,
-					ShapeId:      req.ShapeId,
-					Pos:          req.Pos,
-					Rotation:     req.Rotation,
-					ActivePlayer: game.ActivePlayer,
-				})
+		switch req := cm.m.(type) {
+		case ConnectReq:
+			roomId := req.Room
+			if roomId == 0 {
+				roomId = DEFAULT_ROOM
+				if ci.room != nil {
+					roomId = ci.room.Id
+				}
+			}
+			joinRoom(ci, roomId, req)
+		case RoomJoinReq:
+			joinRoom(ci, req.Room, ConnectReq{Id: ci.id, Room: req.Room, Spectate: req.Spectate})
+		case RoomCreateReq:
+			rules := game.Rules
+			if req.Variant != "" {
+				var err error
+				if rules, err = parseVariant(req.Variant); err != nil {
+					log.Printf("%s: %s\n", ci.Name(), err)
+					ci.Send(ServerRes{S_INVALID_VARIANT})
+					break
+				}
 			}
-		} else {
-			// Game over
-			gameOngoing = false
-			for i := 0; i < squares.NPLAYERS; i++ {
-				SendMsg(lobby[i].conn, ServerRes{Code: S_GAME_OVER})
+			room := createRoom(req.Name, rules)
+			joinRoom(ci, room.Id, ConnectReq{Id: ci.id, Room: room.Id})
+		case RoomListReq:
+			ci.Send(RoomListRes{listRooms()})
+		case RoomLeaveReq:
+			if ci.room == nil {
+				ci.Send(ServerRes{S_NOT_IN_ROOM})
+				break
 			}
-			game.Reset()
-			resetLobby()
-		}
-	case ClientDisconnect:
-		if num == -1 {
-			break
-		}
-		if gameOngoing {
-			log.Printf("Client[%d] %d disconnected while game ongoing", num, ci.id)
-			// just wait for reconnection
-		} else {
-			lobby[num] = nil
+			leaveRoom(ci, req)
+			ci.Send(ServerRes{S_ROOM_LEFT})
+		case ClientDisconnect:
+			if ci.room != nil {
+				leaveRoom(ci, req)
+			}
+		default:
+			if ci.room == nil {
+				ci.Send(ServerRes{S_NOT_IN_ROOM})
+				break
+			}
+			ci.room.ch <- cm
 		}
-	default:
-		log.Printf("Unknown message type: %T\n", req)
 	}
 }
 
-func serverGame(chCM <-chan ClientMessage) {
-	for {
-		processClientMessage(<-chCM)
-	}
-}
-
-func resetLobby() {
-	lobby = make([]*ClientInfo, 0, 2*squares.NPLAYERS)
-}
-
 func serverMain() {
-	resetLobby()
+	rooms[DEFAULT_ROOM] = newRoom(DEFAULT_ROOM, "default", game)
+	nextRoomId = DEFAULT_ROOM + 1
 
 	ln, err := net.Listen("tcp", fServerAddr)
 	if err != nil {
@@ -198,17 +267,14 @@ func serverMain() {
 	defer ln.Close()
 	log.Printf("Server listening on %s\n", ln.Addr())
 
-	chCI := make(chan *ClientInfo, 1)
 	chCM := make(chan ClientMessage, 8)
-	go serverGame(chCM)
-	defer close(chCI)
+	go dispatch(chCM)
 	defer close(chCM)
 
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
 			log.Println(err)
-			conn.Close()
 			continue
 		}
 		go handleClient(&ClientInfo{conn: conn}, chCM)
@@ -0,0 +1,43 @@
+package squares
+
+import "fmt"
+
+// Reason for rejecting a move, the numeric value is stable for use over the network
+type MoveError int
+
+const (
+	_ MoveError = iota
+	ERR_INVALID_SHAPE
+	ERR_INVALID_ROTATION
+	ERR_INVALID_PLAYER
+	ERR_NOT_YOUR_TURN
+	ERR_PIECE_USED
+	ERR_OUT_OF_BOUNDS
+	ERR_OVERLAP
+	ERR_EDGE_CONTACT
+	ERR_NO_CORNER_CONTACT
+	ERR_MISSES_START
+	ERR_ILLEGAL_MOVE // Any other reason
+)
+
+var MOVE_ERROR_S = map[MoveError]string{
+	ERR_INVALID_SHAPE:     "invalid shape",
+	ERR_INVALID_ROTATION:  "invalid rotation",
+	ERR_INVALID_PLAYER:    "invalid player",
+	ERR_NOT_YOUR_TURN:     "not your turn",
+	ERR_PIECE_USED:        "piece already used",
+	ERR_OUT_OF_BOUNDS:     "out of bounds",
+	ERR_OVERLAP:           "overlaps an occupied cell",
+	ERR_EDGE_CONTACT:      "touches own piece edge-to-edge",
+	ERR_NO_CORNER_CONTACT: "no corner contact with own pieces",
+	ERR_MISSES_START:      "does not cover the starting cell",
+	ERR_ILLEGAL_MOVE:      "illegal move",
+}
+
+func (e MoveError) Error() string {
+	s, ok := MOVE_ERROR_S[e]
+	if !ok {
+		return fmt.Sprintf("unknown move error %d", int(e))
+	}
+	return s
+}
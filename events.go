@@ -0,0 +1,83 @@
+package squares
+
+import "fmt"
+
+// Something that happened in a game, passed to every Listener
+type Event interface {
+	String() string
+}
+
+type MovePlacedEvent struct {
+	Move   Move
+	Pieces *PieceSet // Of the game, to write the move
+}
+
+type MoveUndoneEvent struct {
+	Move   Move
+	Pieces *PieceSet
+}
+
+// The player can't place any more pieces
+type PlayerEliminatedEvent struct {
+	PlayerId int
+}
+
+type TurnChangedEvent struct {
+	PlayerId int // The new ActivePlayer
+}
+
+type FirstRoundOverEvent struct{}
+
+type GameOverEvent struct {
+	Standings []Standing // Scored with SCORING_ADVANCED
+}
+
+func (e MovePlacedEvent) String() string {
+	return "Placed " + e.Pieces.FormatMove(e.Move)
+}
+
+func (e MoveUndoneEvent) String() string {
+	return "Took back " + e.Pieces.FormatMove(e.Move)
+}
+
+func (e PlayerEliminatedEvent) String() string {
+	return fmt.Sprintf("Player %d is out", e.PlayerId+1)
+}
+
+func (e TurnChangedEvent) String() string {
+	return fmt.Sprintf("Player %d's turn", e.PlayerId+1)
+}
+
+func (e FirstRoundOverEvent) String() string {
+	return "First round finished"
+}
+
+func (e GameOverEvent) String() string {
+	s := "Game over"
+	for _, st := range e.Standings {
+		s += fmt.Sprintf(", #%d Player %d (%d)", st.Rank, st.PlayerId+1, st.Score)
+	}
+	return s
+}
+
+// Receives game events synchronously, from the goroutine that changes the game
+type Listener interface {
+	HandleEvent(game *Game, e Event)
+}
+
+// Adapter to use an ordinary function as a Listener
+type ListenerFunc func(game *Game, e Event)
+
+func (f ListenerFunc) HandleEvent(game *Game, e Event) {
+	f(game, e)
+}
+
+func (game *Game) AddListener(l Listener) {
+	game.listeners = append(game.listeners, l)
+}
+
+func (game *Game) emit(e Event) {
+	for _, l := range game.listeners {
+		l.HandleEvent(game, e)
+	}
+}
@@ -0,0 +1,76 @@
+package squares
+
+// Take back the last move, return false if there's nothing to undo
+func (game *Game) Undo() bool {
+	n := len(game.History)
+	if n == 0 {
+		return false
+	}
+	m := game.History[n-1]
+	game.History = game.History[:n-1]
+
+	for _, grid := range game.MoveGrids(m) {
+		game.Board[grid.Y][grid.X] = -1
+	}
+	game.ChessUsed[m.PlayerId][m.ShapeId] = false
+	game.LastShape[m.PlayerId] = -1
+	for i := len(game.History) - 1; i >= 0; i-- {
+		if game.History[i].PlayerId == m.PlayerId {
+			game.LastShape[m.PlayerId] = game.History[i].ShapeId
+			break
+		}
+	}
+
+	// The move was made in the first round iff it was the player's first piece
+	game.FirstRound = game.LastShape[m.PlayerId] == -1
+	game.ActivePlayer = m.PlayerId
+	if !game.restoreUndoState() {
+		game.LostPlayers = -1
+		game.rebuildBitboards()
+		game.eliminated = game.GetLostPlayers()
+	}
+
+	game.redo = append(game.redo, m)
+	game.emit(MoveUndoneEvent{m, game.Rules.PieceSet()})
+	return true
+}
+
+// Restore what Insert saved before the last move of History, false if it's
+// missing, e.g. for games loaded from JSON
+func (game *Game) restoreUndoState() bool {
+	// Entries of moves undone without them are stale
+	for len(game.undo) > 0 && game.undo[len(game.undo)-1].moves > len(game.History) {
+		game.undo = game.undo[:len(game.undo)-1]
+	}
+	n := len(game.undo)
+	if n == 0 || game.undo[n-1].moves != len(game.History) {
+		return false
+	}
+	u := game.undo[n-1]
+	game.undo = game.undo[:n-1]
+	game.cellHash, game.occupied, game.forbidden, game.anchors = u.cellHash, u.occupied, u.forbidden, u.anchors
+	game.LostPlayers, game.eliminated = u.lostPlayers, u.eliminated
+	return true
+}
+
+// Replay the last move taken back by Undo, return false if there's nothing to redo
+func (game *Game) Redo() bool {
+	n := len(game.redo)
+	if n == 0 {
+		return false
+	}
+	m := game.redo[n-1]
+	redo := game.redo[:n-1]
+	game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+	game.redo = redo // Insert clears the redo list
+	game.AfterMove()
+	return true
+}
+
+func (game *Game) CanUndo() bool {
+	return len(game.History) > 0
+}
+
+func (game *Game) CanRedo() bool {
+	return len(game.redo) > 0
+}
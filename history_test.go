@@ -0,0 +1,123 @@
+package squares
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// The parts of a game that Undo and Redo must restore
+type gameState struct {
+	Board        [][]int
+	ChessUsed    [][]bool
+	LastShape    []int
+	ActivePlayer int
+	FirstRound   bool
+	LostPlayers  int
+	Hash         uint64
+}
+
+func stateOf(game *Game) gameState {
+	clone := game.Clone()
+	return gameState{clone.Board, clone.ChessUsed, clone.LastShape, clone.ActivePlayer,
+		clone.FirstRound, clone.GetLostPlayers(), clone.Hash()}
+}
+
+func TestUndoRedo(t *testing.T) {
+	tests := []struct {
+		rules    Rules
+		moves    int
+		takeBack int
+	}{
+		{RULES_CLASSIC, 1, 1},
+		{RULES_CLASSIC, 6, 3}, // Back into the first round
+		{RULES_CLASSIC, 30, 10},
+		{RULES_BLOKUS, 50, 50},
+		{RULES_THREE, 20, 5},
+		{RULES_TWO, 12, 4},
+		{RULES_DUO, 3, 2},
+		{RULES_DUO, 100, 8}, // From the end of the game
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		game := NewGame(tt.rules)
+		playRandomMoves(game, r, tt.moves)
+		moves := len(game.History)
+		states := make([]gameState, tt.takeBack+1)
+		for i := 0; i < tt.takeBack; i++ {
+			states[i] = stateOf(game)
+			if !game.Undo() {
+				t.Fatalf("%s after %d moves: can't undo move %d", tt.rules.Name, moves, len(game.History))
+			}
+		}
+		states[tt.takeBack] = stateOf(game)
+
+		for i := tt.takeBack - 1; i >= 0; i-- {
+			if !game.Redo() {
+				t.Fatalf("%s after %d moves: can't redo move %d", tt.rules.Name, moves, len(game.History)+1)
+			}
+			if got := stateOf(game); !reflect.DeepEqual(got, states[i]) {
+				t.Errorf("%s after %d moves: redoing move %d\ngot  %+v\nwant %+v", tt.rules.Name, moves, len(game.History), got, states[i])
+			}
+		}
+		if game.CanRedo() || len(game.History) != moves {
+			t.Errorf("%s after %d moves: %d moves left to redo", tt.rules.Name, moves, len(game.redo))
+		}
+		// Taking back again ends up at the same positions
+		for i := 0; i < tt.takeBack; i++ {
+			game.Undo()
+			if got := stateOf(game); !reflect.DeepEqual(got, states[i+1]) {
+				t.Errorf("%s after %d moves: undoing move %d again\ngot  %+v\nwant %+v", tt.rules.Name, moves, len(game.History)+1, got, states[i+1])
+			}
+		}
+	}
+}
+
+func TestUndoToStart(t *testing.T) {
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		start := stateOf(game)
+		playRandomMoves(game, rand.New(rand.NewSource(2)), 15)
+		for game.Undo() {
+		}
+		if got := stateOf(game); !reflect.DeepEqual(got, start) {
+			t.Errorf("%s: after undoing every move\ngot  %+v\nwant %+v", rules.Name, got, start)
+		}
+	}
+}
+
+func TestInsertClearsRedo(t *testing.T) {
+	game := NewGame(RULES_DUO)
+	playRandomMoves(game, rand.New(rand.NewSource(3)), 4)
+	game.Undo()
+	playRandomMoves(game, rand.New(rand.NewSource(4)), 1)
+	if game.CanRedo() {
+		t.Error("can redo after a new move")
+	}
+}
+
+// Undo restores the bitboards Insert saved, or rebuilds them for moves made
+// before a Clone
+func TestUndoRestoresBitboards(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		playRandomMoves(game, r, 20)
+		game = game.Clone()
+		playRandomMoves(game, r, 20)
+		for game.Undo() {
+			rebuilt := game.Clone()
+			rebuilt.LostPlayers = -1
+			rebuilt.rebuildBitboards()
+			rebuilt.eliminated = rebuilt.GetLostPlayers()
+			if game.cellHash != rebuilt.cellHash || game.occupied != rebuilt.occupied ||
+				game.forbidden != rebuilt.forbidden || game.anchors != rebuilt.anchors {
+				t.Fatalf("%s: bitboards after undoing to %d moves differ from rebuilt ones", rules.Name, len(game.History))
+			}
+			if game.GetLostPlayers() != rebuilt.LostPlayers || game.eliminated != rebuilt.eliminated {
+				t.Fatalf("%s after undoing to %d moves: lost players %b, eliminated %b, want %b, %b", rules.Name,
+					len(game.History), game.GetLostPlayers(), game.eliminated, rebuilt.LostPlayers, rebuilt.eliminated)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package squares
+
+// A single placement of a piece on the board
+type Move struct {
+	ShapeId  int   `json:"shape"`
+	Rotation int   `json:"rotation"`
+	Pos      Coord `json:"pos"` // Top-left corner of the rotated shape
+	PlayerId int   `json:"player_id"`
+}
+
+// The board cells covered by a move
+func (game *Game) MoveGrids(m Move) []Coord {
+	shape := game.Rules.PieceSet().Shape(m.ShapeId, m.Rotation)
+	for i := range shape.Grids {
+		shape.Grids[i] = shape.Grids[i].Add(m.Pos)
+	}
+	return shape.Grids
+}
+
+// Check that a move names a player, shape and rotation of the game and stays on the board
+func (game *Game) moveInRange(m Move) bool {
+	if m.PlayerId < 0 || m.PlayerId >= game.Rules.NPlayers ||
+		m.ShapeId < 0 || m.ShapeId >= game.Rules.PieceSet().Len() ||
+		m.Rotation < 0 || m.Rotation >= NROTATIONS {
+		return false
+	}
+	for _, grid := range game.MoveGrids(m) {
+		if !game.InRange(grid) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if the move can be made by its player in the current position
+func (game *Game) ValidateMove(m Move) error {
+	if m.PlayerId < 0 || m.PlayerId >= game.Rules.NPlayers {
+		return ERR_INVALID_PLAYER
+	}
+	if m.PlayerId != game.ActivePlayer {
+		return ERR_NOT_YOUR_TURN
+	}
+	return game.CheckInsert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId, game.FirstRound)
+}
+
+// Enumerate every legal move for a player in the current position.
+// Rotations that cover the same cells are only reported once.
+func (game *Game) LegalMoves(playerId int) []Move {
+	var anchors []Coord
+	if game.FirstRound {
+		anchors = []Coord{game.Rules.Starts[playerId]}
+	} else {
+		anchors = game.anchorCells(playerId)
+	}
+
+	pieces := game.Rules.PieceSet()
+	moves := make([]Move, 0)
+	for i := 0; i < pieces.Len(); i++ {
+		if game.ChessUsed[playerId][i] {
+			continue
+		}
+		for _, rotation := range pieces.distinct[i] {
+			// The same position may be reached from different anchors
+			var seen Bitboard
+			for _, anchor := range anchors {
+				for _, grid := range pieces.rotated[i][rotation].Grids {
+					pos := anchor.Sub(grid)
+					if !game.InRange(pos) || seen.Test(game.CellIndex(pos)) {
+						continue
+					}
+					seen.Set(game.CellIndex(pos))
+					if game.TryInsert(i, rotation, pos, playerId, game.FirstRound) {
+						moves = append(moves, Move{i, rotation, pos, playerId})
+					}
+				}
+			}
+		}
+	}
+	return moves
+}
+
+// Number of free cells diagonally adjacent to the player's pieces that their
+// next piece may cover
+func (game *Game) AnchorCount(playerId int) int {
+	return game.anchors[playerId].Count()
+}
+
+// Change in the number of the player's anchor cells if the move is made
+func (game *Game) AnchorGain(m Move) int {
+	anchors := game.anchors[m.PlayerId]
+	forbidden := game.forbidden[m.PlayerId]
+	for _, grid := range game.Rules.PieceSet().rotated[m.ShapeId][m.Rotation].Grids {
+		grid = grid.Add(m.Pos)
+		forbidden.Set(game.CellIndex(grid))
+		for _, edge := range EDGES {
+			if check := grid.Add(edge); game.InRange(check) {
+				forbidden.Set(game.CellIndex(check))
+			}
+		}
+		for _, corner := range CORNERS {
+			if check := grid.Add(corner); game.InRange(check) {
+				anchors.Set(game.CellIndex(check))
+			}
+		}
+	}
+	anchors.AndNot(&forbidden)
+	anchors.AndNot(&game.occupied)
+	return anchors.Count() - game.anchors[m.PlayerId].Count()
+}
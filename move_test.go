@@ -0,0 +1,30 @@
+package squares
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestAnchorGain(t *testing.T) {
+	game := NewGame(RULES_CLASSIC)
+	// The monomino in the corner only touches one cell diagonally
+	if gain := game.AnchorGain(Move{0, 0, Coord{0, 0}, 0}); gain != 1 {
+		t.Errorf("monomino in the corner: got %d, want 1", gain)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		for game.ActivePlayer >= 0 {
+			for _, m := range game.LegalMoves(game.ActivePlayer) {
+				after := game.Clone()
+				after.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+				want := len(after.anchorCells(m.PlayerId)) - len(game.anchorCells(m.PlayerId))
+				if got := game.AnchorGain(m); got != want {
+					t.Fatalf("%s: %s gains %d anchors, want %d", game.MarshalPosition(), rules.PieceSet().FormatMove(m), got, want)
+				}
+			}
+			playRandomMoves(game, r, 1)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package squares
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* Move notation:
+ *   [<player>:]<piece>[-<orientation>]@<square>
+ * player: 1-based player number, e.g. "2:"
+ * piece: Shape.Name of the piece, e.g. "I5" or "F" in the standard set
+ * orientation: clockwise quarter turns 0-3, followed by 'b' if the piece is
+ *   flipped to its back first, e.g. "3b" (Shape.Rotate 7). Orientations covering
+ *   the same cells are read as the first of them (see PieceSet.DistinctRotation),
+ *   which is the one written. Left out for pieces that look the same in every
+ *   orientation.
+ * square: top-left corner of the rotated piece, column letters (a, b, ..., z, aa, ab, ...)
+ *   followed by the 1-based row number counted from the top, e.g. "a1" = Coord{0, 0}
+ * Example: "3:L4-1b@e7"
+ */
+
+// Write a move of the standard set, see PieceSet.FormatMove for other sets
+func (m Move) String() string {
+	return PIECES_STANDARD.FormatMove(m)
+}
+
+func (ps *PieceSet) FormatMove(m Move) string {
+	s := ""
+	if m.PlayerId >= 0 {
+		s = fmt.Sprintf("%d:", m.PlayerId+1)
+	}
+	if m.ShapeId < 0 || m.ShapeId >= ps.Len() || m.Rotation < 0 || m.Rotation >= NROTATIONS {
+		return s + fmt.Sprintf("#%d-%d@%s", m.ShapeId, m.Rotation, FormatSquare(m.Pos))
+	}
+	s += ps.Shapes[m.ShapeId].Name
+	if len(ps.distinct[m.ShapeId]) > 1 {
+		s += "-" + formatOrientation(ps.DistinctRotation(m.ShapeId, m.Rotation))
+	}
+	return s + "@" + FormatSquare(m.Pos)
+}
+
+// Parse a move of the standard set written by Move.String.
+// PlayerId is -1 if the player is left out.
+func ParseMove(s string) (Move, error) {
+	return PIECES_STANDARD.ParseMove(s)
+}
+
+// Parse a move written by FormatMove, see ParseMove
+func (ps *PieceSet) ParseMove(s string) (Move, error) {
+	m := Move{PlayerId: -1}
+	rest := s
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil || n < 1 || rest[0] < '1' || rest[0] > '9' {
+			return Move{}, fmt.Errorf("invalid player in move %q", s)
+		}
+		m.PlayerId = n - 1
+		rest = rest[i+1:]
+	}
+
+	i := strings.IndexByte(rest, '@')
+	if i < 0 {
+		return Move{}, fmt.Errorf("missing square in move %q", s)
+	}
+	piece, square := rest[:i], rest[i+1:]
+	pos, err := ParseSquare(square)
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %q: %w", s, err)
+	}
+	m.Pos = pos
+
+	name, orientation, hasOrientation := strings.Cut(piece, "-")
+	var ok bool
+	if m.ShapeId, ok = ps.ShapeId(name); !ok {
+		candidates := make([]string, 0)
+		for _, shape := range ps.Shapes {
+			if name != "" && strings.HasPrefix(shape.Name, name) {
+				candidates = append(candidates, shape.Name)
+			}
+		}
+		if len(candidates) > 0 {
+			return Move{}, fmt.Errorf("ambiguous piece %q in move %q, could be %s", name, s, strings.Join(candidates, ", "))
+		}
+		return Move{}, fmt.Errorf("unknown piece %q in move %q", name, s)
+	}
+
+	if !hasOrientation {
+		if len(ps.distinct[m.ShapeId]) > 1 {
+			return Move{}, fmt.Errorf("missing orientation for piece %s in move %q", name, s)
+		}
+		return m, nil
+	}
+	if m.Rotation, ok = parseOrientation(orientation); !ok {
+		return Move{}, fmt.Errorf("invalid orientation %q in move %q", orientation, s)
+	}
+	m.Rotation = ps.DistinctRotation(m.ShapeId, m.Rotation)
+	return m, nil
+}
+
+// Orientation code of a rotation, e.g. "3b" for 7
+func formatOrientation(rotation int) string {
+	if rotation >= NROTATIONS/2 {
+		return strconv.Itoa(rotation-NROTATIONS/2) + "b"
+	}
+	return strconv.Itoa(rotation)
+}
+
+func parseOrientation(s string) (int, bool) {
+	rotation := 0
+	if strings.HasSuffix(s, "b") {
+		rotation = NROTATIONS / 2
+		s = s[:len(s)-1]
+	}
+	if len(s) != 1 || s[0] < '0' || s[0] > '3' {
+		return 0, false
+	}
+	return rotation + int(s[0]-'0'), true
+}
+
+// Name a board cell, e.g. "a1" for Coord{0, 0}
+func FormatSquare(c Coord) string {
+	return ColumnName(c.X) + strconv.Itoa(c.Y+1)
+}
+
+// Letters for a board column: a, b, ..., z, aa, ab, ...
+func ColumnName(x int) string {
+	col := ""
+	for x++; x > 0; x = (x - 1) / 26 {
+		col = string(rune('a'+(x-1)%26)) + col
+	}
+	return col
+}
+
+func ParseSquare(s string) (Coord, error) {
+	i := 0
+	x := 0
+	for ; i < len(s) && s[i] >= 'a' && s[i] <= 'z'; i++ {
+		x = x*26 + int(s[i]-'a'+1)
+	}
+	y, err := strconv.Atoi(s[i:])
+	// Reject signs and leading zeros, so every square has one spelling only
+	if i == 0 || err != nil || y < 1 || s[i] < '1' || s[i] > '9' {
+		return Coord{}, fmt.Errorf("invalid square %q", s)
+	}
+	return Coord{x - 1, y - 1}, nil
+}
@@ -0,0 +1,83 @@
+package squares
+
+import "testing"
+
+func TestFormatMove(t *testing.T) {
+	tests := []struct {
+		move Move
+		want string
+	}{
+		{Move{ShapeId: 13, Rotation: 0, Pos: Coord{4, 4}, PlayerId: 0}, "1:V5-0@e5"},
+		{Move{ShapeId: 9, Rotation: 1, Pos: Coord{9, 5}, PlayerId: 1}, "2:I5-1@j6"},
+		{Move{ShapeId: 5, Rotation: 5, Pos: Coord{26, 20}, PlayerId: -1}, "L4-1b@aa21"},
+		{Move{ShapeId: 5, Rotation: 7, Pos: Coord{4, 6}, PlayerId: 2}, "3:L4-3b@e7"},
+		{Move{ShapeId: 16, Rotation: 3, Pos: Coord{0, 0}, PlayerId: 3}, "4:X@a1"},
+		{Move{ShapeId: 8, Rotation: 6, Pos: Coord{1, 1}, PlayerId: -1}, "O4@b2"},
+		{Move{ShapeId: 0, Rotation: 0, Pos: Coord{2, 0}, PlayerId: -1}, "I1@c1"},
+		{Move{ShapeId: 21, Rotation: 0, Pos: Coord{0, 0}, PlayerId: -1}, "#21-0@a1"},
+	}
+	for _, tt := range tests {
+		if got := tt.move.String(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.move, got, tt.want)
+		}
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Move
+	}{
+		{"1:V5-0@e5", Move{ShapeId: 13, Rotation: 0, Pos: Coord{4, 4}, PlayerId: 0}},
+		{"L4-1b@aa21", Move{ShapeId: 5, Rotation: 5, Pos: Coord{26, 20}, PlayerId: -1}},
+		{"3:L4-3b@e7", Move{ShapeId: 5, Rotation: 7, Pos: Coord{4, 6}, PlayerId: 2}},
+		{"4:X@a1", Move{ShapeId: 16, Rotation: 0, Pos: Coord{0, 0}, PlayerId: 3}},
+		{"X-3@a1", Move{ShapeId: 16, Rotation: 0, Pos: Coord{0, 0}, PlayerId: -1}},
+		{"O4-2b@b2", Move{ShapeId: 8, Rotation: 0, Pos: Coord{1, 1}, PlayerId: -1}},
+		{"I5-2@j6", Move{ShapeId: 9, Rotation: 0, Pos: Coord{9, 5}, PlayerId: -1}},
+	}
+	for _, tt := range tests {
+		got, err := ParseMove(tt.s)
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+		} else if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoveErrors(t *testing.T) {
+	for _, s := range []string{
+		"", "V5-0", "0:V5-0@e5", "01:V5-0@e5", "x:V5-0@e5", "V5@e5", "V5-4@e5", "V5-8@e5", "V5-01@e5", "V5-0bb@e5", "V5-b@e5", "V5-b0@e5",
+		"V5-x@e5", "Q-0@a1", "I-0@a1", "V5-0@", "V5-0@a0", "V5-0@a01", "V5-0@5", "V5-0@A1",
+	} {
+		if m, err := ParseMove(s); err == nil {
+			t.Errorf("%q: got %+v, want an error", s, m)
+		}
+	}
+}
+
+// Every placement survives writing and reading, covering the same cells
+func TestMoveRoundTrip(t *testing.T) {
+	ps := PIECES_STANDARD
+	for shapeId := 0; shapeId < ps.Len(); shapeId++ {
+		for rotation := 0; rotation < NROTATIONS; rotation++ {
+			m := Move{ShapeId: shapeId, Rotation: rotation, Pos: Coord{shapeId, rotation * 3}, PlayerId: rotation % NPLAYERS}
+			s := ps.FormatMove(m)
+			parsed, err := ps.ParseMove(s)
+			if err != nil {
+				t.Errorf("%+v: %q: %v", m, s, err)
+				continue
+			}
+			if parsed.ShapeId != m.ShapeId || parsed.Pos != m.Pos || parsed.PlayerId != m.PlayerId {
+				t.Errorf("%+v: %q parsed as %+v", m, s, parsed)
+			}
+			if !ps.Shape(shapeId, parsed.Rotation).SameCells(ps.Shape(shapeId, rotation)) {
+				t.Errorf("%+v: %q parsed with rotation %d", m, s, parsed.Rotation)
+			}
+			if again := ps.FormatMove(parsed); again != s {
+				t.Errorf("%+v: %q written again as %q", m, s, again)
+			}
+		}
+	}
+}
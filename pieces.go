@@ -0,0 +1,329 @@
+package squares
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* Piece set files, either JSON:
+ *   {"name": "tetrominoes", "pieces": [{"name": "I4", "grid": ["####"]}, ...]}
+ * or ASCII art: pieces separated by blank lines, each a line with its name
+ * followed by its rows, where '#' marks a cell and '.' or ' ' an empty one:
+ *   I4
+ *   ####
+ *
+ *   T4
+ *   ###
+ *   .#.
+ * Lines starting with ';' are comments. ASCII art sets are named after their file.
+ * Piece names are used in move notation, so they must be unique and can't
+ * contain whitespace, ':', '-' or '@'. Set names are part of variant names
+ * like "duo+tetrominoes", so they can't contain whitespace or '+'.
+ */
+
+// Remaining pieces are stored as a uint64 bitmask in position strings
+const MAX_PIECES = 64
+
+// The pieces each player gets, with lookup tables derived from their shapes
+type PieceSet struct {
+	Name   string
+	Shapes []Shape // Normalized and named, indexed by shape id
+
+	// rotated[i][r] is Shapes[i].Rotate(r), must not be modified
+	rotated [][NROTATIONS]Shape
+	// distinct[i] lists the rotations of shape i that produce different cell sets
+	distinct [][]int
+}
+
+var (
+	// The 21 pieces of the original game
+	PIECES_STANDARD *PieceSet
+
+	PIECE_SETS []*PieceSet // Known sets, see GetPieceSet
+)
+
+func init() {
+	var err error
+	PIECES_STANDARD, err = NewPieceSet("standard", gameShapes)
+	if err != nil {
+		panic(err)
+	}
+	PIECE_SETS = []*PieceSet{PIECES_STANDARD}
+}
+
+// Make a piece set, checking that every shape is a named, connected polyomino
+func NewPieceSet(name string, shapes []Shape) (*PieceSet, error) {
+	if name == "" || strings.ContainsAny(name, "+ \t\r\n") {
+		return nil, fmt.Errorf("invalid piece set name %q", name)
+	}
+	if len(shapes) == 0 || len(shapes) > MAX_PIECES {
+		return nil, fmt.Errorf("piece set %q: expected 1 to %d pieces, got %d", name, MAX_PIECES, len(shapes))
+	}
+	ps := &PieceSet{
+		Name:     name,
+		Shapes:   make([]Shape, len(shapes)),
+		rotated:  make([][NROTATIONS]Shape, len(shapes)),
+		distinct: make([][]int, len(shapes)),
+	}
+	for i, shape := range shapes {
+		if shape.Name == "" || strings.ContainsAny(shape.Name, ":-@ \t\r\n") {
+			return nil, fmt.Errorf("piece set %q: invalid piece name %q", name, shape.Name)
+		}
+		if _, ok := ps.ShapeId(shape.Name); ok {
+			return nil, fmt.Errorf("piece set %q: duplicate piece name %q", name, shape.Name)
+		}
+		if len(shape.Grids) == 0 {
+			return nil, fmt.Errorf("piece set %q: piece %s is empty", name, shape.Name)
+		}
+		shape = namedShape(shape.Name, shape.Grids)
+		if !shape.IsConnected() {
+			return nil, fmt.Errorf("piece set %q: piece %s is not connected", name, shape.Name)
+		}
+		ps.Shapes[i] = shape
+
+		for rotation := 0; rotation < NROTATIONS; rotation++ {
+			ps.rotated[i][rotation] = shape.Rotate(rotation)
+			distinct := true
+			for _, r := range ps.distinct[i] {
+				if ps.rotated[i][r].SameCells(ps.rotated[i][rotation]) {
+					distinct = false
+					break
+				}
+			}
+			if distinct {
+				ps.distinct[i] = append(ps.distinct[i], rotation)
+			}
+		}
+	}
+	return ps, nil
+}
+
+// Check if all cells of a shape are connected through their edges
+func (s Shape) IsConnected() bool {
+	if len(s.Grids) == 0 {
+		return false
+	}
+	reached := []Coord{s.Grids[0]}
+	for i := 0; i < len(reached); i++ {
+	NextEdge:
+		for _, edge := range EDGES {
+			c := reached[i].Add(edge)
+			for _, r := range reached {
+				if r.Equals(c) {
+					continue NextEdge
+				}
+			}
+			for _, grid := range s.Grids {
+				if grid.Equals(c) {
+					reached = append(reached, c)
+					break
+				}
+			}
+		}
+	}
+	return len(reached) == len(s.Grids)
+}
+
+// Number of pieces in the set
+func (ps *PieceSet) Len() int {
+	return len(ps.Shapes)
+}
+
+// Look up a piece by its name
+func (ps *PieceSet) ShapeId(name string) (int, bool) {
+	for i, shape := range ps.Shapes {
+		if shape.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Total number of squares in the set
+func (ps *PieceSet) Squares() int {
+	n := 0
+	for _, shape := range ps.Shapes {
+		n += shape.Size()
+	}
+	return n
+}
+
+func (ps *PieceSet) Shape(shapeId, rotation int) Shape {
+	return ps.Shapes[shapeId].Rotate(rotation)
+}
+
+// The next distinct orientation of a shape, wrapping around
+func (ps *PieceSet) NextRotation(shapeId, rotation int) int {
+	for _, r := range ps.distinct[shapeId] {
+		if r > rotation {
+			return r
+		}
+	}
+	return ps.distinct[shapeId][0]
+}
+
+// The previous distinct orientation of a shape, wrapping around
+func (ps *PieceSet) PrevRotation(shapeId, rotation int) int {
+	rotations := ps.distinct[shapeId]
+	for i := len(rotations) - 1; i >= 0; i-- {
+		if rotations[i] < rotation {
+			return rotations[i]
+		}
+	}
+	return rotations[len(rotations)-1]
+}
+
+// The first distinct orientation of a shape that covers the same cells as rotation
+func (ps *PieceSet) DistinctRotation(shapeId, rotation int) int {
+	for _, r := range ps.distinct[shapeId] {
+		if ps.rotated[shapeId][r].SameCells(ps.rotated[shapeId][rotation]) {
+			return r
+		}
+	}
+	return rotation
+}
+
+// Bitmask of the distinct orientations of a shape
+func (ps *PieceSet) AvailableRotations(shapeId int) int {
+	rotations := 0
+	for _, r := range ps.distinct[shapeId] {
+		rotations |= 1 << r
+	}
+	return rotations
+}
+
+// Look up a known piece set by name
+func GetPieceSet(name string) (*PieceSet, bool) {
+	for _, ps := range PIECE_SETS {
+		if ps.Name == name {
+			return ps, true
+		}
+	}
+	return nil, false
+}
+
+// Make a piece set known to GetPieceSet, so records and positions can refer to it
+func RegisterPieceSet(ps *PieceSet) error {
+	if _, ok := GetPieceSet(ps.Name); ok {
+		return fmt.Errorf("piece set %q already exists", ps.Name)
+	}
+	PIECE_SETS = append(PIECE_SETS, ps)
+	return nil
+}
+
+type pieceJSON struct {
+	Name string   `json:"name"`
+	Grid []string `json:"grid"`
+}
+
+type pieceSetJSON struct {
+	Name   string      `json:"name"`
+	Pieces []pieceJSON `json:"pieces"`
+}
+
+func (ps *PieceSet) MarshalJSON() ([]byte, error) {
+	data := pieceSetJSON{ps.Name, make([]pieceJSON, ps.Len())}
+	for i, shape := range ps.Shapes {
+		data.Pieces[i] = pieceJSON{shape.Name, strings.Split(shape.String(), "\n")}
+	}
+	return json.Marshal(data)
+}
+
+func (ps *PieceSet) UnmarshalJSON(data []byte) error {
+	var plain pieceSetJSON
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return err
+	}
+	loaded, err := plain.pieceSet(plain.Name)
+	if err != nil {
+		return err
+	}
+	*ps = *loaded
+	return nil
+}
+
+func (data pieceSetJSON) pieceSet(defaultName string) (*PieceSet, error) {
+	name := data.Name
+	if name == "" {
+		name = defaultName
+	}
+	shapes := make([]Shape, len(data.Pieces))
+	for i, piece := range data.Pieces {
+		cells, err := parseGrid(piece.Grid)
+		if err != nil {
+			return nil, fmt.Errorf("piece set %q: piece %s: %w", name, piece.Name, err)
+		}
+		shapes[i] = Shape{Name: piece.Name, Grids: cells}
+	}
+	return NewPieceSet(name, shapes)
+}
+
+// Cells marked with '#' in rows of ASCII art
+func parseGrid(rows []string) ([]Coord, error) {
+	cells := make([]Coord, 0)
+	for y, row := range rows {
+		for x, ch := range []byte(row) {
+			switch ch {
+			case '#':
+				cells = append(cells, Coord{x, y})
+			case '.', ' ':
+			default:
+				return nil, fmt.Errorf("invalid character %q in row %d", ch, y+1)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// Read a piece set in either format, name is used if the data doesn't have one
+func ReadPieceSet(r io.Reader, name string) (*PieceSet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var plain pieceSetJSON
+		if err := json.Unmarshal(data, &plain); err != nil {
+			return nil, err
+		}
+		return plain.pieceSet(name)
+	}
+
+	plain := pieceSetJSON{Name: name, Pieces: make([]pieceJSON, 0)}
+	var piece *pieceJSON
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case strings.HasPrefix(line, ";"):
+		case line == "":
+			piece = nil
+		case piece == nil:
+			plain.Pieces = append(plain.Pieces, pieceJSON{Name: strings.TrimSpace(line)})
+			piece = &plain.Pieces[len(plain.Pieces)-1]
+		default:
+			piece.Grid = append(piece.Grid, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return plain.pieceSet(name)
+}
+
+// Read a piece set file, named after the file unless it says otherwise
+func LoadPieceSet(filename string) (*PieceSet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return ReadPieceSet(f, name)
+}
@@ -0,0 +1,112 @@
+package squares
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Enumerate the free polyominoes with 1 to n squares, i.e. the shapes that
+// differ in all 8 orientations. FreePolyominoes(n)[k-1] lists those with k
+// squares in canonical orientation, sorted by their cells.
+func FreePolyominoes(n int) [][]Shape {
+	orders := make([][]Shape, 0, n)
+	if n < 1 {
+		return orders
+	}
+	orders = append(orders, []Shape{NewShape([]Coord{{0, 0}})})
+	for k := 2; k <= n; k++ {
+		seen := make(map[string]bool)
+		grown := make([]Shape, 0)
+		for _, shape := range orders[k-2] {
+			// Add a square next to any of the existing ones
+			for _, grid := range shape.Grids {
+			NextEdge:
+				for _, edge := range EDGES {
+					c := grid.Add(edge)
+					for _, other := range shape.Grids {
+						if other.Equals(c) {
+							continue NextEdge
+						}
+					}
+					cells := make([]Coord, len(shape.Grids), len(shape.Grids)+1)
+					copy(cells, shape.Grids)
+					candidate := NewShape(append(cells, c)).Canonical()
+					if key := fmt.Sprint(candidate.Grids); !seen[key] {
+						seen[key] = true
+						grown = append(grown, candidate)
+					}
+				}
+			}
+		}
+		sort.Slice(grown, func(i, j int) bool {
+			return lessCells(grown[i].Grids, grown[j].Grids)
+		})
+		orders = append(orders, grown)
+	}
+	return orders
+}
+
+// The orientation of a shape with the smallest cells, so shapes that are the
+// same up to rotation and mirroring have the same canonical form
+func (s Shape) Canonical() Shape {
+	best := s.Rotate(0)
+	for rotation := 1; rotation < NROTATIONS; rotation++ {
+		if rotated := s.Rotate(rotation); lessCells(rotated.Grids, best.Grids) {
+			best = rotated
+		}
+	}
+	return best
+}
+
+// Check if two shapes are the same up to rotation and mirroring
+func (s Shape) SameFreeShape(s2 Shape) bool {
+	return s.Canonical().SameCells(s2.Canonical())
+}
+
+// Order normalized cell lists row by row, shorter lists first
+func lessCells(a, b []Coord) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	for i := range a {
+		if a[i].Y != b[i].Y {
+			return a[i].Y < b[i].Y
+		}
+		if a[i].X != b[i].X {
+			return a[i].X < b[i].X
+		}
+	}
+	return false
+}
+
+// Make a piece set of all free polyominoes with the given numbers of squares.
+// Pieces of the standard set keep their names, others are named by their
+// size and position in FreePolyominoes, e.g. "6.12".
+func GeneratePieceSet(name string, orders ...int) (*PieceSet, error) {
+	maxOrder := 0
+	for _, order := range orders {
+		if order < 1 {
+			return nil, fmt.Errorf("invalid polyomino order %d", order)
+		}
+		if order > maxOrder {
+			maxOrder = order
+		}
+	}
+	polyominoes := FreePolyominoes(maxOrder)
+
+	shapes := make([]Shape, 0)
+	for _, order := range orders {
+	NextShape:
+		for i, shape := range polyominoes[order-1] {
+			for _, standard := range PIECES_STANDARD.Shapes {
+				if standard.SameFreeShape(shape) {
+					shapes = append(shapes, standard)
+					continue NextShape
+				}
+			}
+			shape.Name = fmt.Sprintf("%d.%d", order, i+1)
+			shapes = append(shapes, shape)
+		}
+	}
+	return NewPieceSet(name, shapes)
+}
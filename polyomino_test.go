@@ -0,0 +1,64 @@
+package squares
+
+import "testing"
+
+func TestFreePolyominoCounts(t *testing.T) {
+	// OEIS A000105
+	want := []int{1, 1, 2, 5, 12, 35}
+	polyominoes := FreePolyominoes(len(want))
+	if len(polyominoes) != len(want) {
+		t.Fatalf("got %d orders, want %d", len(polyominoes), len(want))
+	}
+	for k, shapes := range polyominoes {
+		if len(shapes) != want[k] {
+			t.Errorf("%d squares: got %d polyominoes, want %d", k+1, len(shapes), want[k])
+		}
+		for i, shape := range shapes {
+			if shape.Size() != k+1 || !shape.IsConnected() {
+				t.Errorf("%d squares: invalid polyomino %v", k+1, shape.Grids)
+			}
+			for _, other := range shapes[:i] {
+				if shape.SameFreeShape(other) {
+					t.Errorf("%d squares: %v found twice", k+1, shape.Grids)
+				}
+			}
+		}
+	}
+}
+
+// The standard set is exactly the free polyominoes with 1 to 5 squares
+func TestFreePolyominoesMatchStandardSet(t *testing.T) {
+	polyominoes := make([]Shape, 0)
+	for _, shapes := range FreePolyominoes(5) {
+		polyominoes = append(polyominoes, shapes...)
+	}
+	if len(polyominoes) != PIECES_STANDARD.Len() {
+		t.Fatalf("got %d polyominoes, standard set has %d pieces", len(polyominoes), PIECES_STANDARD.Len())
+	}
+	for _, standard := range PIECES_STANDARD.Shapes {
+		found := 0
+		for _, shape := range polyominoes {
+			if shape.SameFreeShape(standard) {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Errorf("piece %s matches %d polyominoes, want 1", standard.Name, found)
+		}
+	}
+}
+
+func TestGeneratePieceSetKeepsStandardNames(t *testing.T) {
+	ps, err := GeneratePieceSet("pentominoes", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.Len() != 12 {
+		t.Fatalf("got %d pieces, want 12", ps.Len())
+	}
+	for _, shape := range ps.Shapes {
+		if _, ok := PIECES_STANDARD.ShapeId(shape.Name); !ok {
+			t.Errorf("pentomino %s isn't named after the standard set", shape.Name)
+		}
+	}
+}
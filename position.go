@@ -0,0 +1,258 @@
+package squares
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* Position string, five fields separated by spaces:
+ *   <variant> <board> <remaining pieces> <active player> <first round>
+ * variant: Name of the rules, see VARIANTS, followed by '+' and the name of
+ *   the piece set if it isn't the standard one, e.g. "duo+pentominoes".
+ *   The piece set must be known to GetPieceSet.
+ * board: Rows from top to bottom separated by '/'. Each row is a list of runs,
+ *   a run is an optional count followed by '.' for empty cells or a letter for
+ *   a player's cells ('a' = player 1, 'b' = player 2, ...), e.g. "3.2a16."
+ * remaining pieces: For each player, the hex bitmask of unused shape ids
+ *   (bit i = shape i), separated by ','
+ * active player: 1-based player number, or '-' if the game is over
+ * first round: 'f' during the first round, '-' otherwise
+ *
+ * The move history is not part of a position, so a parsed game can't be undone
+ * and doesn't know which piece each player placed last: LastShape is -1 for
+ * every player, and Score never gives BONUS_MONOMINO_LAST.
+ */
+
+func (game *Game) MarshalPosition() string {
+	rows := make([]string, game.Rules.Height)
+	for y, row := range game.Board {
+		var sb strings.Builder
+		for x := 0; x < len(row); {
+			n := 1
+			for x+n < len(row) && row[x+n] == row[x] {
+				n++
+			}
+			if n > 1 {
+				sb.WriteString(strconv.Itoa(n))
+			}
+			sb.WriteByte(positionSymbol(row[x]))
+			x += n
+		}
+		rows[y] = sb.String()
+	}
+
+	remaining := make([]string, game.Rules.NPlayers)
+	for p := range remaining {
+		mask := uint64(0)
+		for i, used := range game.ChessUsed[p] {
+			if !used {
+				mask |= 1 << i
+			}
+		}
+		remaining[p] = strconv.FormatUint(mask, 16)
+	}
+
+	active := "-"
+	if game.ActivePlayer >= 0 {
+		active = strconv.Itoa(game.ActivePlayer + 1)
+	}
+	firstRound := "-"
+	if game.FirstRound {
+		firstRound = "f"
+	}
+	variant := game.Rules.Name
+	if pieces := game.Rules.PieceSet(); pieces != PIECES_STANDARD {
+		variant += "+" + pieces.Name
+	}
+	return strings.Join([]string{
+		variant,
+		strings.Join(rows, "/"),
+		strings.Join(remaining, ","),
+		active,
+		firstRound,
+	}, " ")
+}
+
+func positionSymbol(cell int) byte {
+	if cell < 0 {
+		return '.'
+	}
+	return byte('a' + cell)
+}
+
+// Create a game from a position string, checking that the pieces on the board
+// are exactly the used ones
+func ParsePosition(s string) (*Game, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in position, got %d", len(fields))
+	}
+	variant, piecesName, custom := strings.Cut(fields[0], "+")
+	rules, ok := GetRules(variant)
+	if !ok {
+		return nil, fmt.Errorf("unknown variant %q", variant)
+	}
+	if custom {
+		if rules.Pieces, ok = GetPieceSet(piecesName); !ok {
+			return nil, fmt.Errorf("unknown piece set %q", piecesName)
+		}
+	}
+	game := NewGame(rules)
+	n := rules.PieceSet().Len()
+
+	rows := strings.Split(fields[1], "/")
+	if len(rows) != rules.Height {
+		return nil, fmt.Errorf("expected %d rows, got %d", rules.Height, len(rows))
+	}
+	for y, row := range rows {
+		x := 0
+		for i := 0; i < len(row); i++ {
+			j := i
+			for j < len(row) && row[j] >= '0' && row[j] <= '9' {
+				j++
+			}
+			count := 1
+			if j > i {
+				var err error
+				if count, err = strconv.Atoi(row[i:j]); err != nil || count < 2 || row[i] == '0' {
+					return nil, fmt.Errorf("row %d: invalid count %q", y+1, row[i:j])
+				}
+			}
+			if j == len(row) {
+				return nil, fmt.Errorf("row %d: count without a symbol", y+1)
+			}
+			cell := -1
+			if row[j] != '.' {
+				cell = int(row[j]) - 'a'
+				if cell < 0 || cell >= rules.NPlayers {
+					return nil, fmt.Errorf("row %d: invalid symbol %q", y+1, row[j])
+				}
+			}
+			if x+count > rules.Width {
+				return nil, fmt.Errorf("row %d: more than %d cells", y+1, rules.Width)
+			}
+			for ; count > 0; count-- {
+				game.Board[y][x] = cell
+				x++
+			}
+			i = j
+		}
+		if x != rules.Width {
+			return nil, fmt.Errorf("row %d: expected %d cells, got %d", y+1, rules.Width, x)
+		}
+	}
+
+	remaining := strings.Split(fields[2], ",")
+	if len(remaining) != rules.NPlayers {
+		return nil, fmt.Errorf("expected remaining pieces for %d players, got %d", rules.NPlayers, len(remaining))
+	}
+	for p, field := range remaining {
+		mask, err := strconv.ParseUint(field, 16, 64)
+		if err != nil || mask>>n != 0 {
+			return nil, fmt.Errorf("invalid remaining pieces %q for player %d", field, p+1)
+		}
+		for i := 0; i < n; i++ {
+			game.ChessUsed[p][i] = mask&(1<<i) == 0
+		}
+	}
+
+	switch fields[3] {
+	case "-":
+		game.ActivePlayer = -1
+	default:
+		player, err := strconv.Atoi(fields[3])
+		if err != nil || player < 1 || player > rules.NPlayers {
+			return nil, fmt.Errorf("invalid active player %q", fields[3])
+		}
+		game.ActivePlayer = player - 1
+	}
+	switch fields[4] {
+	case "f":
+		game.FirstRound = true
+	case "-":
+		game.FirstRound = false
+	default:
+		return nil, fmt.Errorf("invalid first round flag %q", fields[4])
+	}
+
+	if err := game.checkPieces(); err != nil {
+		return nil, err
+	}
+	game.LostPlayers = -1
+	game.rebuildBitboards()
+	game.eliminated = game.GetLostPlayers()
+	return game, nil
+}
+
+// Match every group of edge-connected cells of a player with one of their used pieces
+func (game *Game) checkPieces() error {
+	var visited Bitboard
+	pieces := game.Rules.PieceSet()
+	unmatched := make([][]bool, game.Rules.NPlayers)
+	for p := range unmatched {
+		unmatched[p] = make([]bool, pieces.Len())
+		copy(unmatched[p], game.ChessUsed[p])
+		used := 0
+		for _, u := range game.ChessUsed[p] {
+			if u {
+				used++
+			}
+		}
+		if game.FirstRound && used > 1 {
+			return fmt.Errorf("player %d has more than one piece in the first round", p+1)
+		}
+		if !game.FirstRound && used == 0 {
+			return fmt.Errorf("player %d has no pieces after the first round", p+1)
+		}
+	}
+
+	for y := 0; y < game.Rules.Height; y++ {
+		for x := 0; x < game.Rules.Width; x++ {
+			p := game.Board[y][x]
+			if p < 0 || visited.Test(game.CellIndex(Coord{x, y})) {
+				continue
+			}
+			// Flood fill the piece
+			cells := []Coord{{x, y}}
+			visited.Set(game.CellIndex(Coord{x, y}))
+			for i := 0; i < len(cells); i++ {
+				for _, edge := range EDGES {
+					c := cells[i].Add(edge)
+					if game.InRange(c) && game.Board[c.Y][c.X] == p && !visited.Test(game.CellIndex(c)) {
+						visited.Set(game.CellIndex(c))
+						cells = append(cells, c)
+					}
+				}
+			}
+
+			piece := NewShape(cells)
+			shapeId := -1
+		FindShape:
+			for i := 0; i < pieces.Len(); i++ {
+				if !unmatched[p][i] {
+					continue
+				}
+				for _, rotation := range pieces.distinct[i] {
+					if pieces.rotated[i][rotation].SameCells(piece) {
+						shapeId = i
+						break FindShape
+					}
+				}
+			}
+			if shapeId < 0 {
+				return fmt.Errorf("cells of player %d at %s don't form one of their used pieces", p+1, FormatSquare(Coord{x, y}))
+			}
+			unmatched[p][shapeId] = false
+		}
+	}
+
+	for p := range unmatched {
+		for i, u := range unmatched[p] {
+			if u {
+				return fmt.Errorf("shape %s of player %d is used but not on the board", pieces.Shapes[i].Name, p+1)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package squares
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+const (
+	DUO_START      = "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"
+	DUO_THREE_MOVE = "duo 14./14./4.a9./4.a9./4.3a7./.3a10./.a.a4.b5./8.b5./8.2b4./9.b4./14./14./14./14. fdfff,1ff7ff 2 -"
+)
+
+func TestMarshalPosition(t *testing.T) {
+	game := NewGame(RULES_DUO)
+	if got := game.MarshalPosition(); got != DUO_START {
+		t.Errorf("got %q, want %q", got, DUO_START)
+	}
+	for _, s := range []string{"1:V5-3@e3", "2:N-1b@i7", "1:U-0@b6"} {
+		m, err := ParseMove(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := game.ValidateMove(m); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+		game.AfterMove()
+	}
+	if got := game.MarshalPosition(); got != DUO_THREE_MOVE {
+		t.Errorf("got %q, want %q", got, DUO_THREE_MOVE)
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, rules := range VARIANTS {
+		for _, n := range []int{0, 1, 5, 20, 60, 200} {
+			game := NewGame(rules)
+			playRandomMoves(game, r, n)
+			s := game.MarshalPosition()
+			parsed, err := ParsePosition(s)
+			if err != nil {
+				t.Errorf("%q: %v", s, err)
+				continue
+			}
+			if !reflect.DeepEqual(parsed.Board, game.Board) || !reflect.DeepEqual(parsed.ChessUsed, game.ChessUsed) {
+				t.Errorf("%q: parsed a different board or pieces", s)
+			}
+			if parsed.ActivePlayer != game.ActivePlayer || parsed.FirstRound != game.FirstRound {
+				t.Errorf("%q: parsed player %d, first round %v, want %d, %v",
+					s, parsed.ActivePlayer, parsed.FirstRound, game.ActivePlayer, game.FirstRound)
+			}
+			if parsed.GetLostPlayers() != game.GetLostPlayers() || parsed.Hash() != game.Hash() {
+				t.Errorf("%q: parsed lost players %b, hash %x, want %b, %x",
+					s, parsed.GetLostPlayers(), parsed.Hash(), game.GetLostPlayers(), game.Hash())
+			}
+			if again := parsed.MarshalPosition(); again != s {
+				t.Errorf("%q written again as %q", s, again)
+			}
+		}
+	}
+}
+
+func TestParsePositionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{"missing field", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1"},
+		{"unknown variant", "quad 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"unknown piece set", "duo+nope 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"missing row", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"long row", "duo 15./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"short row", "duo 13./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"zero count", "duo 014./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"count without symbol", "duo 14/14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"third player in duo", "duo 14./14./14./14./4.c9./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 f"},
+		{"pieces of one player", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff 1 f"},
+		{"invalid pieces", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,xyz 1 f"},
+		{"invalid player", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 3 f"},
+		{"invalid first round", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 1 x"},
+
+		// Well-formed but inconsistent
+		{"cells without a piece", "duo 14./14./14./14./4.a9./14./14./14./14./14./14./14./14./14. 1fffff,1fffff 2 f"},
+		{"piece not on the board", "duo 14./14./14./14./14./14./14./14./14./14./14./14./14./14. 1ffffe,1fffff 2 f"},
+		{"wrong piece", "duo 14./14./14./14./4.a9./14./14./14./14./14./14./14./14./14. 1ffffd,1fffff 2 f"},
+		{"two pieces in the first round", "duo 14./14./4.a9./4.a9./4.3a7./.3a10./.a.a4.b5./8.b5./8.2b4./9.b4./14./14./14./14. fdfff,1ff7ff 2 f"},
+		{"no pieces after the first round", DUO_START[:len(DUO_START)-1] + "-"},
+	}
+	for _, tt := range tests {
+		if _, err := ParsePosition(tt.s); err == nil {
+			t.Errorf("%s: %q parsed without an error", tt.name, tt.s)
+		}
+	}
+}
+
+// Positions don't say which piece was placed last, anything using it copes
+func TestParsePositionLastShape(t *testing.T) {
+	game, err := ParsePosition(DUO_THREE_MOVE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, last := range game.LastShape {
+		if last != -1 {
+			t.Errorf("player %d: got last shape %d, want -1", p+1, last)
+		}
+	}
+
+	played := NewGame(RULES_DUO)
+	playRandomMoves(played, rand.New(rand.NewSource(1)), 5)
+	parsed, err := ParsePosition(played.MarshalPosition())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := 0; p < RULES_DUO.NPlayers; p++ {
+		opts := RenderOptions{ShowAnchors: true, AnchorPlayer: p}
+		if got, want := parsed.Render(opts), played.Render(opts); got != want {
+			t.Errorf("player %d: parsed anchors\n%s\nwant\n%s", p+1, got, want)
+		}
+	}
+}
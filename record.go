@@ -0,0 +1,216 @@
+package squares
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Game record format:
+ * A header of tag lines, one tag per line:
+ *   [Name "value"]
+ * The value is a double-quoted string with Go escaping rules.
+ * Well-known tags:
+ *   Variant: Name of the rules, see VARIANTS. Defaults to "classic".
+ *   Pieces:  Name of the piece set, see GetPieceSet. Defaults to "standard".
+ *   Date:    Date the game was played, YYYY.MM.DD
+ *   Player1, Player2, ...: Names of the players
+ *   Result:  Final scores (SCORING_ADVANCED) in player order separated by spaces,
+ *            or "*" for an unfinished game
+ * Followed by the moves in the order they were made, written in move notation
+ * (see notation.go) and separated by whitespace. The player prefix may be left out.
+ * Everything from a ';' outside of tag values to the end of a line is a comment.
+ *
+ * Example:
+ *   [Variant "duo"]
+ *   [Date "2026.10.18"]
+ *   [Result "*"]
+ *
+ *   1:V5-0@e5
+ *   2:I5-1@j6
+ */
+
+type Tag struct {
+	Name  string
+	Value string
+}
+
+type Record struct {
+	Tags  []Tag // In file order
+	Moves []Move
+}
+
+const RECORD_DATE_FORMAT = "2006.01.02"
+
+// Create a record of the game played so far
+func NewRecord(game *Game) *Record {
+	rec := &Record{Moves: make([]Move, len(game.History))}
+	copy(rec.Moves, game.History)
+	rec.SetTag("Variant", game.Rules.Name)
+	if pieces := game.Rules.PieceSet(); pieces != PIECES_STANDARD {
+		rec.SetTag("Pieces", pieces.Name)
+	}
+	rec.SetTag("Date", time.Now().Format(RECORD_DATE_FORMAT))
+	rec.SetTag("Result", ResultString(game))
+	return rec
+}
+
+// Value of the Result tag for a game
+func ResultString(game *Game) string {
+	if game.ActivePlayer >= 0 {
+		return "*"
+	}
+	scores := make([]string, game.Rules.NPlayers)
+	for i := range scores {
+		scores[i] = strconv.Itoa(game.Score(i, SCORING_ADVANCED))
+	}
+	return strings.Join(scores, " ")
+}
+
+// Value of a tag, empty if not present
+func (rec *Record) Tag(name string) string {
+	for _, tag := range rec.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// Replace the value of a tag or add it at the end of the header
+func (rec *Record) SetTag(name, value string) {
+	for i := range rec.Tags {
+		if rec.Tags[i].Name == name {
+			rec.Tags[i].Value = value
+			return
+		}
+	}
+	rec.Tags = append(rec.Tags, Tag{name, value})
+}
+
+func (rec *Record) Rules() (Rules, error) {
+	name := rec.Tag("Variant")
+	if name == "" {
+		name = RULES_CLASSIC.Name
+	}
+	rules, ok := GetRules(name)
+	if !ok {
+		return Rules{}, fmt.Errorf("unknown variant %q", name)
+	}
+	if name := rec.Tag("Pieces"); name != "" {
+		if rules.Pieces, ok = GetPieceSet(name); !ok {
+			return Rules{}, fmt.Errorf("unknown piece set %q", name)
+		}
+	}
+	return rules, nil
+}
+
+// Play all moves on a new game, checking that every move is legal
+func (rec *Record) Replay() (*Game, error) {
+	rules, err := rec.Rules()
+	if err != nil {
+		return nil, err
+	}
+	game := NewGame(rules)
+	for i, m := range rec.Moves {
+		if game.ActivePlayer < 0 {
+			return nil, fmt.Errorf("move %d (%s): game is already over", i+1, rules.PieceSet().FormatMove(m))
+		}
+		if m.PlayerId < 0 {
+			m.PlayerId = game.ActivePlayer
+		}
+		if err := game.ValidateMove(m); err != nil {
+			return nil, fmt.Errorf("move %d (%s): %w", i+1, rules.PieceSet().FormatMove(m), err)
+		}
+		game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+		game.AfterMove()
+	}
+	return game, nil
+}
+
+func (rec *Record) WriteTo(w io.Writer) (int64, error) {
+	rules, err := rec.Rules()
+	if err != nil {
+		return 0, err
+	}
+	var sb strings.Builder
+	for _, tag := range rec.Tags {
+		fmt.Fprintf(&sb, "[%s %s]\n", tag.Name, strconv.Quote(tag.Value))
+	}
+	sb.WriteString("\n")
+	for _, m := range rec.Moves {
+		sb.WriteString(rules.PieceSet().FormatMove(m))
+		sb.WriteString("\n")
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// Cut a line at the first ';' that isn't inside a quoted tag value
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++ // skip the escaped character
+			}
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// Parse a game record and make sure all its moves are legal
+func ReadRecord(r io.Reader) (*Record, error) {
+	rec := &Record{Tags: make([]Tag, 0), Moves: make([]Move, 0)}
+	var pieces *PieceSet // Known once the tags are over
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if strings.HasPrefix(line, "[") {
+			if len(rec.Moves) > 0 {
+				return nil, fmt.Errorf("line %d: tag after moves", lineNo)
+			}
+			name, value, ok := strings.Cut(strings.TrimSuffix(line[1:], "]"), " ")
+			if !ok || !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed tag", lineNo)
+			}
+			value, err := strconv.Unquote(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed value for tag %s", lineNo, name)
+			}
+			rec.Tags = append(rec.Tags, Tag{name, value})
+			continue
+		}
+		if line != "" && pieces == nil {
+			rules, err := rec.Rules()
+			if err != nil {
+				return nil, err
+			}
+			pieces = rules.PieceSet()
+		}
+		for _, field := range strings.Fields(line) {
+			m, err := pieces.ParseMove(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			rec.Moves = append(rec.Moves, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := rec.Replay(); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,82 @@
+package squares
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		playRandomMoves(game, r, 30)
+		rec := NewRecord(game)
+		rec.SetTag("Player1", "Alice \"A\"; the first")
+		var sb strings.Builder
+		if _, err := rec.WriteTo(&sb); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadRecord(strings.NewReader(sb.String()))
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", rules.Name, err, sb.String())
+		}
+		if !reflect.DeepEqual(read, rec) {
+			t.Errorf("%s: read\n%+v\nwant\n%+v", rules.Name, read, rec)
+		}
+		replayed, err := read.Replay()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stateOf(replayed), stateOf(game); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: replayed\n%+v\nwant\n%+v", rules.Name, got, want)
+		}
+	}
+}
+
+// Moves may leave out the player, and comments are ignored
+func TestReadRecord(t *testing.T) {
+	s := `[Variant "duo"] ; comment
+[Event "a;b"]
+
+V5-3@e3 2:N-1b@i7 ; first moves
+U-0@b6
+`
+	rec, err := ReadRecord(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Tag("Event"); got != "a;b" {
+		t.Errorf("got tag %q, want %q", got, "a;b")
+	}
+	game, err := rec.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := game.MarshalPosition(); got != DUO_THREE_MOVE {
+		t.Errorf("got position %q, want %q", got, DUO_THREE_MOVE)
+	}
+}
+
+func TestReadRecordErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{"malformed tag", "[Variant duo]\n"},
+		{"unterminated tag", "[Variant \"duo\"\n"},
+		{"tag after moves", "[Variant \"duo\"]\nV5-3@e3\n[Event \"x\"]\n"},
+		{"unknown variant", "[Variant \"quad\"]\nV5-3@e3\n"},
+		{"unknown piece set", "[Variant \"duo\"]\n[Pieces \"nope\"]\nV5-3@e3\n"},
+		{"malformed move", "[Variant \"duo\"]\nV5-3e3\n"},
+		{"unknown piece", "[Variant \"duo\"]\nQ-0@e3\n"},
+		{"illegal move", "[Variant \"duo\"]\nV5-3@a1\n"},
+		{"wrong player", "[Variant \"duo\"]\n2:V5-3@e3\n"},
+	}
+	for _, tt := range tests {
+		if _, err := ReadRecord(strings.NewReader(tt.s)); err == nil {
+			t.Errorf("%s: %q read without an error", tt.name, tt.s)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package squares
+
+import (
+	"fmt"
+	"strings"
+)
+
+type RenderOptions struct {
+	Unicode       bool // Use Unicode symbols instead of ASCII letters
+	Color         bool // Color pieces with ANSI escape sequences
+	HighlightLast bool // Mark the cells of the last move
+	ShowAnchors   bool // Mark the cells AnchorPlayer's next piece may touch
+	AnchorPlayer  int
+}
+
+var (
+	// Glyphs for each player, the second set marks the last move
+	ASCII_GLYPHS        = []string{"A", "B", "C", "D"}
+	ASCII_LAST_GLYPHS   = []string{"a", "b", "c", "d"}
+	UNICODE_GLYPHS      = []string{"■", "●", "▲", "◆"}
+	UNICODE_LAST_GLYPHS = []string{"□", "○", "△", "◇"}
+
+	// Red, green, blue and yellow, like the client's themes
+	ANSI_COLORS = []string{"\x1b[31m", "\x1b[32m", "\x1b[34m", "\x1b[33m"}
+)
+
+const (
+	ANSI_RESET   = "\x1b[0m"
+	ANSI_REVERSE = "\x1b[7m"
+)
+
+// The board with default options
+func (game *Game) String() string {
+	return game.Render(RenderOptions{HighlightLast: true})
+}
+
+// Draw the board as text, with column letters and row numbers as in move notation
+func (game *Game) Render(opts RenderOptions) string {
+	glyphs, lastGlyphs := ASCII_GLYPHS, ASCII_LAST_GLYPHS
+	empty, anchor := ".", "+"
+	if opts.Unicode {
+		glyphs, lastGlyphs = UNICODE_GLYPHS, UNICODE_LAST_GLYPHS
+		empty, anchor = "·", "◦"
+	}
+
+	var last Bitboard
+	if opts.HighlightLast && len(game.History) > 0 {
+		for _, grid := range game.MoveGrids(game.History[len(game.History)-1]) {
+			last.Set(game.CellIndex(grid))
+		}
+	}
+	var anchors Bitboard
+	if opts.ShowAnchors && opts.AnchorPlayer >= 0 && opts.AnchorPlayer < game.Rules.NPlayers {
+		// Not LastShape, parsed positions don't have it
+		if game.PlacedSquares(opts.AnchorPlayer) == 0 {
+			// No pieces yet, the first one must cover the starting cell
+			anchors.Set(game.CellIndex(game.Rules.Starts[opts.AnchorPlayer]))
+		} else {
+			anchors = game.anchors[opts.AnchorPlayer]
+		}
+	}
+
+	var sb strings.Builder
+	labelWidth := len(fmt.Sprint(game.Rules.Height))
+	sb.WriteString(strings.Repeat(" ", labelWidth))
+	for x := 0; x < game.Rules.Width; x++ {
+		fmt.Fprintf(&sb, "%2s", ColumnName(x))
+	}
+	sb.WriteString("\n")
+
+	for y := 0; y < game.Rules.Height; y++ {
+		fmt.Fprintf(&sb, "%*d", labelWidth, y+1)
+		for x := 0; x < game.Rules.Width; x++ {
+			sb.WriteString(" ")
+			i := game.CellIndex(Coord{x, y})
+			p := game.Board[y][x]
+			switch {
+			case p < 0 && anchors.Test(i):
+				sb.WriteString(anchor)
+			case p < 0:
+				sb.WriteString(empty)
+			default:
+				glyph := glyphs[p]
+				if last.Test(i) {
+					glyph = lastGlyphs[p]
+				}
+				if opts.Color {
+					prefix := ANSI_COLORS[p]
+					if last.Test(i) {
+						prefix += ANSI_REVERSE
+					}
+					glyph = prefix + glyph + ANSI_RESET
+				}
+				sb.WriteString(glyph)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Draw the shape with '#' for its cells
+func (s Shape) String() string {
+	rows := make([][]byte, s.Height)
+	for y := range rows {
+		rows[y] = []byte(strings.Repeat(".", s.Width))
+	}
+	for _, grid := range s.Grids {
+		rows[grid.Y][grid.X] = '#'
+	}
+	lines := make([]string, len(rows))
+	for y, row := range rows {
+		lines[y] = string(row)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,93 @@
+package squares
+
+import "fmt"
+
+// Board and seating setup of a game variant
+type Rules struct {
+	Name      string  `json:"name"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	NPlayers  int     `json:"players"`
+	Starts    []Coord `json:"starts"`     // Starts[p] is the cell player p's first piece must cover
+	TurnOrder []int   `json:"turn_order"` // Player ids in the order they move
+
+	Pieces *PieceSet `json:"pieces,omitempty"` // nil = PIECES_STANDARD, see PieceSet()
+}
+
+var (
+	// The original 4-player game of this project
+	RULES_CLASSIC = Rules{"classic", 21, 21, 4, []Coord{{0, 0}, {20, 0}, {20, 20}, {0, 20}}, []int{0, 1, 2, 3}, nil}
+	// The official Blokus board
+	RULES_BLOKUS = Rules{"blokus", 20, 20, 4, []Coord{{0, 0}, {19, 0}, {19, 19}, {0, 19}}, []int{0, 1, 2, 3}, nil}
+	RULES_THREE  = Rules{"three", 20, 20, 3, []Coord{{0, 0}, {19, 0}, {19, 19}}, []int{0, 1, 2}, nil}
+	RULES_TWO    = Rules{"two", 20, 20, 2, []Coord{{0, 0}, {19, 19}}, []int{0, 1}, nil}
+	// Blokus Duo
+	RULES_DUO = Rules{"duo", 14, 14, 2, []Coord{{4, 4}, {9, 9}}, []int{0, 1}, nil}
+
+	VARIANTS = []Rules{RULES_CLASSIC, RULES_BLOKUS, RULES_THREE, RULES_TWO, RULES_DUO}
+)
+
+// Look up one of the predefined variants by name
+func GetRules(name string) (Rules, bool) {
+	for _, rules := range VARIANTS {
+		if rules.Name == name {
+			return rules, true
+		}
+	}
+	return Rules{}, false
+}
+
+func (r Rules) Validate() error {
+	if r.Width <= 0 || r.Height <= 0 || r.Width*r.Height > BITBOARD_WORDS*64 {
+		return fmt.Errorf("invalid board size %dx%d", r.Width, r.Height)
+	}
+	if r.NPlayers <= 0 || r.NPlayers > NPLAYERS {
+		return fmt.Errorf("invalid number of players %d", r.NPlayers)
+	}
+	if len(r.Starts) != r.NPlayers {
+		return fmt.Errorf("expected %d starting cells, got %d", r.NPlayers, len(r.Starts))
+	}
+	for _, start := range r.Starts {
+		if !r.InRange(start) {
+			return fmt.Errorf("starting cell %v out of range", start)
+		}
+	}
+	if len(r.TurnOrder) != r.NPlayers {
+		return fmt.Errorf("expected %d players in turn order, got %d", r.NPlayers, len(r.TurnOrder))
+	}
+	seen := 0
+	for _, p := range r.TurnOrder {
+		if p < 0 || p >= r.NPlayers || seen&(1<<p) != 0 {
+			return fmt.Errorf("invalid turn order %v", r.TurnOrder)
+		}
+		seen |= 1 << p
+	}
+	return nil
+}
+
+// The pieces each player gets
+func (r Rules) PieceSet() *PieceSet {
+	if r.Pieces == nil {
+		return PIECES_STANDARD
+	}
+	return r.Pieces
+}
+
+func (r Rules) InRange(c Coord) bool {
+	return c.X >= 0 && c.X < r.Width && c.Y >= 0 && c.Y < r.Height
+}
+
+// The player moving after playerId, regardless of whether they can move
+func (r Rules) NextPlayer(playerId int) int {
+	for i, p := range r.TurnOrder {
+		if p == playerId {
+			return r.TurnOrder[(i+1)%len(r.TurnOrder)]
+		}
+	}
+	return r.TurnOrder[0]
+}
+
+// Check if playerId is the last to move in each round
+func (r Rules) IsLastPlayer(playerId int) bool {
+	return r.TurnOrder[len(r.TurnOrder)-1] == playerId
+}
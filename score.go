@@ -0,0 +1,91 @@
+package squares
+
+import "sort"
+
+type ScoringMode int
+
+const (
+	SCORING_BASIC    ScoringMode = iota // One point for each placed square
+	SCORING_ADVANCED                    // Official rules: penalty for remaining squares plus bonuses
+)
+
+const (
+	BONUS_ALL_PLACED    = 15 // Placed all pieces
+	BONUS_MONOMINO_LAST = 5  // Placed all pieces and the monomino was the last one
+)
+
+// A player's final position in a game
+type Standing struct {
+	PlayerId int `json:"player_id"`
+	Score    int `json:"score"`
+	Rank     int `json:"rank"` // 1 = winner, tied players share the same rank
+}
+
+// Number of squares in the pieces a player has placed
+func (game *Game) PlacedSquares(playerId int) int {
+	n := 0
+	for i, shape := range game.Rules.PieceSet().Shapes {
+		if game.ChessUsed[playerId][i] {
+			n += shape.Size()
+		}
+	}
+	return n
+}
+
+// Number of squares in the pieces a player has yet to place
+func (game *Game) RemainingSquares(playerId int) int {
+	n := 0
+	for i, shape := range game.Rules.PieceSet().Shapes {
+		if !game.ChessUsed[playerId][i] {
+			n += shape.Size()
+		}
+	}
+	return n
+}
+
+// Score of a player, LastShape decides BONUS_MONOMINO_LAST in SCORING_ADVANCED
+func (game *Game) Score(playerId int, mode ScoringMode) int {
+	if mode == SCORING_BASIC {
+		return game.PlacedSquares(playerId)
+	}
+
+	remaining := game.RemainingSquares(playerId)
+	if remaining > 0 {
+		return -remaining
+	}
+	score := BONUS_ALL_PLACED
+	if last := game.LastShape[playerId]; last >= 0 && game.Rules.PieceSet().Shapes[last].Size() == 1 {
+		score += BONUS_MONOMINO_LAST
+	}
+	return score
+}
+
+// Rank all players by score, best first
+func (game *Game) Standings(mode ScoringMode) []Standing {
+	standings := make([]Standing, game.Rules.NPlayers)
+	for i := range standings {
+		standings[i] = Standing{PlayerId: i, Score: game.Score(i, mode)}
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Score > standings[j].Score
+	})
+	for i := range standings {
+		if i > 0 && standings[i].Score == standings[i-1].Score {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+	return standings
+}
+
+// All players sharing the first place
+func Winners(standings []Standing) []int {
+	winners := make([]int, 0, 1)
+	for _, s := range standings {
+		if s.Rank == 1 {
+			winners = append(winners, s.PlayerId)
+		}
+	}
+	return winners
+}
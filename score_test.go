@@ -0,0 +1,83 @@
+package squares
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Mark pieces of a player as placed, the last one given is placed last
+func placePieces(game *Game, playerId int, shapeIds ...int) {
+	for _, id := range shapeIds {
+		game.ChessUsed[playerId][id] = true
+		game.LastShape[playerId] = id
+	}
+}
+
+func TestScore(t *testing.T) {
+	pieces := PIECES_STANDARD
+	total, monomino := 0, -1
+	all := make([]int, 0, pieces.Len())
+	for i, shape := range pieces.Shapes {
+		total += shape.Size()
+		if shape.Size() == 1 {
+			monomino = i
+		} else {
+			all = append(all, i)
+		}
+	}
+
+	game := NewGame(RULES_CLASSIC)
+	placePieces(game, 0, monomino, all[0])
+	placed := 1 + pieces.Shapes[all[0]].Size()
+	placePieces(game, 1, all...)
+	placePieces(game, 1, monomino)
+	placePieces(game, 2, monomino)
+	placePieces(game, 2, all...)
+
+	tests := []struct {
+		playerId int
+		mode     ScoringMode
+		want     int
+	}{
+		{0, SCORING_BASIC, placed},
+		{0, SCORING_ADVANCED, placed - total},
+		{1, SCORING_BASIC, total},
+		{1, SCORING_ADVANCED, BONUS_ALL_PLACED + BONUS_MONOMINO_LAST},
+		{2, SCORING_ADVANCED, BONUS_ALL_PLACED},
+		{3, SCORING_BASIC, 0},
+		{3, SCORING_ADVANCED, -total},
+	}
+	for _, tt := range tests {
+		if got := game.Score(tt.playerId, tt.mode); got != tt.want {
+			t.Errorf("player %d, mode %d: got %d, want %d", tt.playerId+1, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestStandings(t *testing.T) {
+	// Shapes 0 and 1 are the monomino and domino, shape 2 one of the trominoes
+	if pieces := PIECES_STANDARD.Shapes; pieces[0].Size()+pieces[1].Size() != 3 || pieces[2].Size() != 3 {
+		t.Fatal("unexpected order of the standard pieces")
+	}
+	game := NewGame(RULES_CLASSIC)
+	placePieces(game, 0, 0, 1)
+	placePieces(game, 1, 2)
+	placePieces(game, 2, 0, 1)
+	want := []Standing{{0, 3, 1}, {1, 3, 1}, {2, 3, 1}, {3, 0, 4}} // Ties keep the player order
+	got := game.Standings(SCORING_BASIC)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if winners := Winners(got); !reflect.DeepEqual(winners, []int{0, 1, 2}) {
+		t.Errorf("got winners %v, want players 0, 1 and 2", winners)
+	}
+
+	placePieces(game, 1, 3)
+	got = game.Standings(SCORING_BASIC)
+	if winners := Winners(got); !reflect.DeepEqual(winners, []int{1}) {
+		t.Errorf("got winners %v, want player 1", winners)
+	}
+	if got[1].Rank != 2 || got[2].Rank != 2 {
+		t.Errorf("got %v, want players 0 and 2 tied in second place", got)
+	}
+}
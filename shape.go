@@ -1,43 +1,64 @@
 package squares
 
+import "sort"
+
 const (
-	NSHAPES    = 21 // number of shapes
+	NSHAPES    = 21 // number of shapes in the standard set
 	NROTATIONS = 8  // number of rotations
 )
 
+// A polyomino. Shapes made by NewShape, GetShape and Rotate are normalized:
+// the cells start at Coord{0, 0} and are sorted row by row.
 type Shape struct {
-	Grids          []Coord
-	Width, Height  int
-	MirrorSymmetry bool
-	RotateSymmetry bool // 180deg rotational symmetry
+	Name          string // Used in move notation, empty for shapes that aren't pieces
+	Grids         []Coord
+	Width, Height int
 }
 
+// The standard pieces with their usual names, see PIECES_STANDARD
 var gameShapes = []Shape{
-	{[]Coord{{0, 0}}, 1, 1, true, true}, // id = 0
-	{[]Coord{{0, 0}, {1, 0}}, 2, 1, true, true},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}}, 3, 1, true, true},
-	{[]Coord{{0, 0}, {1, 0}, {0, 1}}, 2, 2, true, false},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}}, 4, 1, true, true},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}}, 3, 2, false, false},
-	{[]Coord{{0, 0}, {1, 0}, {1, 1}, {2, 1}}, 3, 2, false, true},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {1, 1}}, 3, 2, true, false},
-	{[]Coord{{0, 0}, {1, 0}, {0, 1}, {1, 1}}, 2, 2, true, true}, // id = 8
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}, 5, 1, true, true},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {0, 1}}, 4, 2, false, false},
-	{[]Coord{{0, 0}, {1, 0}, {1, 1}, {2, 1}, {3, 1}}, 4, 2, false, false},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {1, 1}}, 4, 2, false, false},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}}, 3, 3, true, false},
-	{[]Coord{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {2, 2}}, 3, 3, false, true},
-	{[]Coord{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {1, 2}}, 3, 3, false, false},
-	{[]Coord{{1, 0}, {0, 1}, {1, 1}, {2, 1}, {1, 2}}, 3, 3, true, true}, // id = 16
-	{[]Coord{{0, 0}, {1, 0}, {1, 1}, {2, 1}, {2, 2}}, 3, 3, true, false},
-	{[]Coord{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {0, 2}}, 3, 3, true, false},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}}, 3, 2, false, false},
-	{[]Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {2, 1}}, 3, 2, true, false},
+	namedShape("I1", []Coord{{0, 0}}), // id = 0
+	namedShape("I2", []Coord{{0, 0}, {1, 0}}),
+	namedShape("I3", []Coord{{0, 0}, {1, 0}, {2, 0}}),
+	namedShape("V3", []Coord{{0, 0}, {1, 0}, {0, 1}}),
+	namedShape("I4", []Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}}),
+	namedShape("L4", []Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}}),
+	namedShape("Z4", []Coord{{0, 0}, {1, 0}, {1, 1}, {2, 1}}),
+	namedShape("T4", []Coord{{0, 0}, {1, 0}, {2, 0}, {1, 1}}),
+	namedShape("O4", []Coord{{0, 0}, {1, 0}, {0, 1}, {1, 1}}), // id = 8
+	namedShape("I5", []Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}),
+	namedShape("L5", []Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {0, 1}}),
+	namedShape("N", []Coord{{0, 0}, {1, 0}, {1, 1}, {2, 1}, {3, 1}}),
+	namedShape("Y", []Coord{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {1, 1}}),
+	namedShape("V5", []Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}}),
+	namedShape("Z", []Coord{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {2, 2}}),
+	namedShape("F", []Coord{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {1, 2}}),
+	namedShape("X", []Coord{{1, 0}, {0, 1}, {1, 1}, {2, 1}, {1, 2}}), // id = 16
+	namedShape("W", []Coord{{0, 0}, {1, 0}, {1, 1}, {2, 1}, {2, 2}}),
+	namedShape("T5", []Coord{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {0, 2}}),
+	namedShape("P", []Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}}),
+	namedShape("U", []Coord{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {2, 1}}),
 }
 
+// A shape of the standard set, see PieceSet.Shape for other sets
 func GetShape(num, rotation int) Shape {
-	return gameShapes[num].Rotate(rotation)
+	return PIECES_STANDARD.Shape(num, rotation)
+}
+
+// Id of a shape of the standard set, see PieceSet.ShapeId for other sets
+func GetShapeId(name string) (int, bool) {
+	return PIECES_STANDARD.ShapeId(name)
+}
+
+func namedShape(name string, cells []Coord) Shape {
+	shape := NewShape(cells)
+	shape.Name = name
+	return shape
+}
+
+// Number of squares in the shape
+func (s Shape) Size() int {
+	return len(s.Grids)
 }
 
 func (s Shape) Rotate(rotation int) Shape {
@@ -77,52 +98,61 @@ func (s Shape) Rotate(rotation int) Shape {
 		}
 		res.Grids[i] = dst
 	}
+	res = NewShape(res.Grids)
+	res.Name = s.Name
 	return res
 }
 
+// Rotation helpers for the standard set, see the PieceSet methods for other sets
+
 func GetNextRotation(shapeId, rotation int) int {
-	switch shapeId {
-	case 0, 8, 16:
-		return 0
-	}
-	rotation++
-	if gameShapes[shapeId].RotateSymmetry && rotation&2 != 0 {
-		rotation += 2
-	}
-	if gameShapes[shapeId].MirrorSymmetry {
-		rotation %= 4
-	} else {
-		rotation %= 8
-	}
-	return rotation
+	return PIECES_STANDARD.NextRotation(shapeId, rotation)
 }
 
 func GetPrevRotation(shapeId, rotation int) int {
-	switch shapeId {
-	case 0, 8, 16:
-		return 0
-	}
-	rotation = (rotation + 7) % 8
-	if gameShapes[shapeId].RotateSymmetry {
-		rotation &= ^2
-	}
-	if gameShapes[shapeId].MirrorSymmetry {
-		rotation &= ^4
-	}
-	return rotation
+	return PIECES_STANDARD.PrevRotation(shapeId, rotation)
 }
 
 func AvailableRotations(shapeId int) int {
-	switch shapeId {
-	case 0, 8, 16:
-		return 1
+	return PIECES_STANDARD.AvailableRotations(shapeId)
+}
+
+// Check if two normalized shapes cover exactly the same cells
+func (s Shape) SameCells(s2 Shape) bool {
+	if len(s.Grids) != len(s2.Grids) {
+		return false
 	}
-	rotations := 3
-	if !gameShapes[shapeId].RotateSymmetry {
-		rotations |= rotations << 2
+	for i := range s.Grids {
+		if !s.Grids[i].Equals(s2.Grids[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Make a normalized shape from a list of cells anywhere on the board
+func NewShape(cells []Coord) Shape {
+	minX, minY := cells[0].X, cells[0].Y
+	maxX, maxY := minX, minY
+	for _, c := range cells {
+		if c.X < minX {
+			minX = c.X
+		} else if c.X > maxX {
+			maxX = c.X
+		}
+		if c.Y < minY {
+			minY = c.Y
+		} else if c.Y > maxY {
+			maxY = c.Y
+		}
 	}
-	if !gameShapes[shapeId].MirrorSymmetry {
-		rotations |= rotations << 4
+	shape := Shape{Grids: make([]Coord, len(cells)), Width: maxX - minX + 1, Height: maxY - minY + 1}
+	for i, c := range cells {
+		shape.Grids[i] = c.SubXY(minX, minY)
 	}
-	return rotations
+	sort.Slice(shape.Grids, func(i, j int) bool {
+		a, b := shape.Grids[i], shape.Grids[j]
+		return a.Y < b.Y || a.Y == b.Y && a.X < b.X
+	})
+	return shape
 }
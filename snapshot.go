@@ -0,0 +1,102 @@
+package squares
+
+// A read-only copy of a game at one point in time.
+// All methods are safe to call from several goroutines at once, while the
+// game it was taken from keeps going.
+type Snapshot struct {
+	game *Game // Never modified, with LostPlayers already calculated
+}
+
+func (game *Game) Snapshot() Snapshot {
+	clone := game.Clone()
+	clone.GetLostPlayers()
+	return Snapshot{clone}
+}
+
+// A new game starting from the snapshot, to be modified freely
+func (s Snapshot) Game() *Game {
+	return s.game.Clone()
+}
+
+// Make a move on a copy of the snapshot, the snapshot itself is left alone
+func (s Snapshot) Apply(m Move) (Snapshot, error) {
+	if err := s.game.ValidateMove(m); err != nil {
+		return Snapshot{}, err
+	}
+	game := s.game.Clone()
+	game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+	game.AfterMove()
+	game.GetLostPlayers()
+	return Snapshot{game}, nil
+}
+
+// The rules with their own slices, the piece set is shared as it's never modified
+func (s Snapshot) Rules() Rules {
+	rules := s.game.Rules
+	rules.Starts = append([]Coord(nil), rules.Starts...)
+	rules.TurnOrder = append([]int(nil), rules.TurnOrder...)
+	return rules
+}
+
+func (s Snapshot) At(x, y int) int {
+	return s.game.At(x, y)
+}
+
+func (s Snapshot) GetUsed(playerId, shapeId int) bool {
+	return s.game.GetUsed(playerId, shapeId)
+}
+
+func (s Snapshot) LastShape(playerId int) int {
+	return s.game.LastShape[playerId]
+}
+
+func (s Snapshot) ActivePlayer() int {
+	return s.game.ActivePlayer
+}
+
+func (s Snapshot) FirstRound() bool {
+	return s.game.FirstRound
+}
+
+func (s Snapshot) LostPlayers() int {
+	return s.game.LostPlayers
+}
+
+// All moves made so far, in order
+func (s Snapshot) History() []Move {
+	history := make([]Move, len(s.game.History))
+	copy(history, s.game.History)
+	return history
+}
+
+func (s Snapshot) ValidateMove(m Move) error {
+	return s.game.ValidateMove(m)
+}
+
+func (s Snapshot) LegalMoves(playerId int) []Move {
+	return s.game.LegalMoves(playerId)
+}
+
+func (s Snapshot) Score(playerId int, mode ScoringMode) int {
+	return s.game.Score(playerId, mode)
+}
+
+func (s Snapshot) Standings(mode ScoringMode) []Standing {
+	return s.game.Standings(mode)
+}
+
+func (s Snapshot) Hash() uint64 {
+	return s.game.Hash()
+}
+
+func (s Snapshot) MarshalPosition() string {
+	return s.game.MarshalPosition()
+}
+
+func (s Snapshot) String() string {
+	return s.game.String()
+}
+
+func (s Snapshot) Render(opts RenderOptions) string {
+	return s.game.Render(opts)
+}
@@ -0,0 +1,64 @@
+package squares
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Changing what a snapshot hands out doesn't change the snapshot
+func TestSnapshotCopies(t *testing.T) {
+	game := NewGame(RULES_DUO)
+	playRandomMoves(game, rand.New(rand.NewSource(1)), 4)
+	s := game.Snapshot()
+	rules := s.Rules()
+	rules.Starts[0] = Coord{0, 0}
+	rules.TurnOrder[0] = 1
+	if got := s.Rules(); got.Starts[0] != (Coord{4, 4}) || got.TurnOrder[0] != 0 {
+		t.Errorf("got rules %+v, want duo", got)
+	}
+	history := s.History()
+	history[0].ShapeId = -1
+	if got := s.History(); !reflect.DeepEqual(got, game.History) {
+		t.Errorf("got history %v, want %v", got, game.History)
+	}
+}
+
+// Readers of a snapshot race neither each other nor the game going on.
+// Only meaningful with -race.
+func TestSnapshotConcurrentReads(t *testing.T) {
+	game := NewGame(RULES_DUO)
+	r := rand.New(rand.NewSource(1))
+	playRandomMoves(game, r, 10)
+	s := game.Snapshot()
+	want := s.MarshalPosition()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(playerId int) {
+			defer wg.Done()
+			rules := s.Rules()
+			rules.Starts[0] = Coord{playerId, playerId}
+			for _, m := range s.LegalMoves(playerId % 2) {
+				s.ValidateMove(m)
+			}
+			s.Score(playerId%2, SCORING_ADVANCED)
+			s.Standings(SCORING_BASIC)
+			s.Render(RenderOptions{ShowAnchors: true, AnchorPlayer: playerId % 2})
+			s.Hash()
+			s.LostPlayers()
+			if moves := s.LegalMoves(s.ActivePlayer()); len(moves) > 0 {
+				if _, err := s.Apply(moves[0]); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	playRandomMoves(game, r, 10)
+	wg.Wait()
+	if got := s.MarshalPosition(); got != want {
+		t.Errorf("snapshot changed to %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package squares
+
+// Zobrist keys, generated from a fixed seed so hashes can be stored and compared across runs
+var (
+	zobristCells      [NPLAYERS][BITBOARD_WORDS * 64]uint64
+	zobristActive     [NPLAYERS + 1]uint64 // Last one is for game over
+	zobristFirstRound uint64
+)
+
+const ZOBRIST_SEED = 0x5371_7561_7265_7321
+
+func init() {
+	state := uint64(ZOBRIST_SEED)
+	for p := range zobristCells {
+		for i := range zobristCells[p] {
+			zobristCells[p][i] = splitmix64(&state)
+		}
+	}
+	for p := range zobristActive {
+		zobristActive[p] = splitmix64(&state)
+	}
+	zobristFirstRound = splitmix64(&state)
+}
+
+// https://prng.di.unimi.it/splitmix64.c
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// 64-bit Zobrist hash of the position: the board, the active player and the first-round flag.
+// Used pieces aren't hashed separately as they follow from the board.
+// Only comparable between games of the same variant.
+func (game *Game) Hash() uint64 {
+	h := game.cellHash
+	if game.ActivePlayer >= 0 {
+		h ^= zobristActive[game.ActivePlayer]
+	} else {
+		h ^= zobristActive[NPLAYERS]
+	}
+	if game.FirstRound {
+		h ^= zobristFirstRound
+	}
+	return h
+}
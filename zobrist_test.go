@@ -0,0 +1,93 @@
+package squares
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Play moves from the start, false if one of them isn't legal
+func replayMoves(rules Rules, moves []Move) (*Game, bool) {
+	game := NewGame(rules)
+	for _, m := range moves {
+		if game.ValidateMove(m) != nil {
+			return nil, false
+		}
+		game.Insert(m.ShapeId, m.Rotation, m.Pos, m.PlayerId)
+		game.AfterMove()
+	}
+	return game, true
+}
+
+// Keys come from a fixed seed, so hashes may be stored and compared across runs
+func TestHashIsStable(t *testing.T) {
+	tests := []struct {
+		position string
+		want     uint64
+	}{
+		{DUO_START, 0xdd50d265ac2f9f2f},
+		{DUO_THREE_MOVE, 0x25d56144e12cc9e7},
+	}
+	for _, tt := range tests {
+		game, err := ParsePosition(tt.position)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := game.Hash(); got != tt.want {
+			t.Errorf("%q: got hash %#x, want %#x", tt.position, got, tt.want)
+		}
+	}
+}
+
+// Swapping two later moves of a player reaches the same position and hash
+func TestHashTranspositions(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tested := 0
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		playRandomMoves(game, r, 40)
+		moves := game.History
+		for i := rules.NPlayers; i < len(moves); i++ {
+			for j := i + 1; j < len(moves); j++ {
+				if moves[i].PlayerId != moves[j].PlayerId {
+					continue
+				}
+				swapped := append([]Move(nil), moves...)
+				swapped[i], swapped[j] = swapped[j], swapped[i]
+				other, ok := replayMoves(rules, swapped)
+				if !ok || other.ActivePlayer != game.ActivePlayer {
+					continue
+				}
+				tested++
+				if other.Hash() != game.Hash() {
+					t.Errorf("%s: swapping moves %d and %d: got hash %#x, want %#x", rules.Name, i+1, j+1, other.Hash(), game.Hash())
+				}
+			}
+		}
+	}
+	if tested == 0 {
+		t.Error("no transpositions found")
+	}
+}
+
+// Hashes change with every move and are the same when the game is loaded
+func TestHashFollowsMoves(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, rules := range VARIANTS {
+		game := NewGame(rules)
+		seen := map[uint64]int{game.Hash(): 0}
+		for game.ActivePlayer >= 0 {
+			playRandomMoves(game, r, 1)
+			if n, ok := seen[game.Hash()]; ok {
+				t.Fatalf("%s: hash %#x after %d moves, same as after %d", rules.Name, game.Hash(), len(game.History), n)
+			}
+			seen[game.Hash()] = len(game.History)
+			loaded, err := ParsePosition(game.MarshalPosition())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Hash() != game.Hash() {
+				t.Fatalf("%s after %d moves: loaded hash %#x, want %#x", rules.Name, len(game.History), loaded.Hash(), game.Hash())
+			}
+		}
+	}
+}